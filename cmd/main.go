@@ -1,12 +1,25 @@
 package main
 
 import (
+	"context"
+	"path/filepath"
+	"time"
+
 	"github.com/gleb-korostelev/CosmicPizza.git/config"
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
 	cosmicorder "github.com/gleb-korostelev/CosmicPizza.git/service/cosmicOrder"
+	filestore "github.com/gleb-korostelev/CosmicPizza.git/service/fileStore"
 	ingredienttree "github.com/gleb-korostelev/CosmicPizza.git/service/ingredientTree"
+	"github.com/gleb-korostelev/CosmicPizza.git/service/persistence"
+	"github.com/gleb-korostelev/CosmicPizza.git/service/pricing"
+	"github.com/gleb-korostelev/CosmicPizza.git/service/promotions"
+	"github.com/gleb-korostelev/CosmicPizza.git/service/reaper"
+	shardedorder "github.com/gleb-korostelev/CosmicPizza.git/service/shardedOrder"
+	"github.com/gleb-korostelev/CosmicPizza.git/service/storage"
 	testfunctions "github.com/gleb-korostelev/CosmicPizza.git/testFunctions"
 	"github.com/gleb-korostelev/CosmicPizza.git/tools/closer"
 	"github.com/gleb-korostelev/CosmicPizza.git/tools/logger"
+	"github.com/gleb-korostelev/CosmicPizza.git/utils"
 )
 
 func main() {
@@ -15,21 +28,115 @@ func main() {
 		closer.Wait()
 		closer.CloseAll()
 	}()
-	orderList := cosmicorder.NewService()
-	ingredientTree := ingredienttree.NewService()
+	// Prices with the default promo codes plus the promotions rule set
+	pricer := pricing.Default()
+	if rules, err := promotions.LoadFile(config.PromotionsFile); err != nil {
+		logger.Errorf("Promotions disabled: %v", err)
+	} else {
+		pricer = pricing.NewService(pricing.DefaultPriceList(), pricing.WithPromoCodes(pricing.DefaultPromoCodes...), rules.PricingOption())
+	}
+
+	// Placed orders expire after their planet's TTL
+	ttl := cosmicorder.TTLPolicy{Default: config.OrderTTL * time.Millisecond, Planets: make(map[string]time.Duration)}
+	for planet, ms := range config.PlanetOrderTTL {
+		ttl.Planets[planet] = time.Duration(ms) * time.Millisecond
+	}
+	expiry := cosmicorder.ExpireCancel
+	if config.ExpiredOrderAction == "remove" {
+		expiry = cosmicorder.ExpireRemove
+	}
+	orderOpts := []cosmicorder.Option{
+		cosmicorder.WithPricer(pricer),
+		cosmicorder.WithIDAllocator(utils.OrderIDs),
+		cosmicorder.WithTTL(ttl),
+		cosmicorder.WithExpiryAction(expiry),
+	}
+
+	var (
+		orderList      storage.OrderStore
+		ingredientTree storage.IngredientStore
+	)
+	switch config.StorageBackend {
+	case "file":
+		// Every write rewrites the JSON files, so the write-ahead log is not needed
+		orders, err := filestore.NewOrderStore(filepath.Join(config.PersistenceDir, "orders.json"), orderOpts...)
+		if err != nil {
+			logger.Fatalf("Cannot open the order store: %v", err)
+		}
+		ingredients, err := filestore.NewIngredientStore(filepath.Join(config.PersistenceDir, "ingredients.json"))
+		if err != nil {
+			logger.Fatalf("Cannot open the ingredient store: %v", err)
+		}
+		orderList, ingredientTree = orders, ingredients
+	case "sharded":
+		// Workers touching different orders do not wait for each other
+		orderList = shardedorder.NewService(config.OrderShardNumber, orderOpts...)
+		ingredientTree = ingredienttree.NewService()
+	default:
+		orderList = cosmicorder.NewService(orderOpts...)
+		ingredientTree = ingredienttree.NewService()
+	}
+
+	// Restore the state of the previous run and journal every mutation of this one
+	var journal utils.Journal
+	if config.PersistenceEnabled && config.StorageBackend != "file" {
+		store, err := persistence.Open(config.PersistenceDir,
+			persistence.WithSyncPolicy(persistence.SyncInterval, config.WALSyncInterval*time.Millisecond),
+			persistence.WithSnapshotInterval(config.SnapshotInterval*time.Millisecond))
+		if err != nil {
+			logger.Fatalf("Cannot open the persistence store: %v", err)
+		}
+		err = store.Recover(orderList, ingredientTree, func(task models.Task) error {
+			return utils.SwitchProcessTasks(context.Background(), task, orderList, ingredientTree, nil)
+		})
+		if err != nil {
+			logger.Fatalf("Cannot recover the persisted state: %v", err)
+		}
+		closer.Add(store)
+		journal = store
+	}
+
+	// Cancel or remove the orders that waited too long for the kitchen
+	var orderReaper *reaper.Reaper
+	if expiring, ok := orderList.(storage.ExpiringOrderStore); ok {
+		r, err := reaper.New(utils.ExpireOrders(expiring, journal), config.ReaperInterval*time.Millisecond)
+		if err != nil {
+			logger.Fatalf("Cannot start the order reaper: %v", err)
+		}
+		closer.Add(r)
+		orderReaper = r
+	}
 
 	// This are some test functions a did
 	// testfunctions.WorkerPoolSimulation(config.OrderNumber, config.IngredientNumber, orderList, ingredientTree)
 	// testfunctions.TryInsertSameIngredients(ingredientTree)
-	// testfunctions.TryInsertBadIndexOrder(orderList)
+	// testfunctions.TryInsertBadIndexOrder(cosmicorder.NewService())
+	// testfunctions.PipelineSimulation(config.NumberOfWorkersForFunOut, orderList, ingredientTree)
+	// testfunctions.WindowedPipelineSimulation(orderList, ingredientTree)
+	// testfunctions.EventFeedSimulation(cosmicorder.NewService())
+	// testfunctions.AuditSimulation(cosmicorder.NewService())
+	// testfunctions.ReorderSimulation(cosmicorder.NewService())
 
 	// This is the main function of the project
-	testfunctions.FullConcurrencySimulation(config.NumberOfWorkersForFunOut, orderList, ingredientTree)
+	testfunctions.FullConcurrencySimulation(config.NumberOfWorkersForFunOut, orderList, ingredientTree, journal)
 
 	// calculates min max and the sum of all ingredients
 	min, max, sum := ingredientTree.FindMinMaxSum()
 
-	logger.Infof("Final Orders List Processed")
+	logger.Infof("Final Orders List Processed: %d orders", orderList.Len())
+	for order := range orderList.All() {
+		logger.Infof("Order #%d from %s: %s (%s)", order.OrderID, order.Planet, order.PizzaType, order.Status)
+		if order.Receipt != nil {
+			logger.Infof("Order #%d total: %s (subtotal %s, discounts %v, delivery %s, tax %s)",
+				order.OrderID, order.Receipt.Total, order.Receipt.Subtotal, order.Receipt.Discounts, order.Receipt.DeliveryFee, order.Receipt.Tax)
+		}
+	}
+	logger.Infof("Orders per planet: %v", orderList.CountByPlanet())
+	logger.Infof("Orders per pizza type: %v", orderList.CountByPizzaType())
+	if orderReaper != nil {
+		stats := orderReaper.Stats()
+		logger.Infof("Expired orders: %d (per planet %v, per status %v)", stats.Expired, stats.ByPlanet, stats.ByStatus)
+	}
 	logger.Infof("Final Ingredient Tree Values: %v", ingredientTree.TraverseInOrder())
 	logger.Infof("Final max/min/sum of values: %v, %v, %v", min, max, sum)
 }
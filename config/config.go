@@ -14,6 +14,15 @@ const (
 	// MaxIngredientNumber is a maximum random ingredient number in data type int
 	MaxIngredientNumber = 100
 
+	// MaxOrderItems maximum number of line items in a random order
+	MaxOrderItems = 3
+
+	// MaxItemQuantity maximum quantity of a random line item
+	MaxItemQuantity = 3
+
+	// MaxExtraToppings maximum number of extra toppings of a random line item
+	MaxExtraToppings = 2
+
 	// OrderNumber number  of orders to be randomized for workerPool
 	OrderNumber = 5
 
@@ -23,9 +32,93 @@ const (
 	// OrderTaskNumber number of generated orders for GenerateTasks
 	OrderTaskNumber = 5
 
+	// StatusTaskNumber number of generated order status transitions for GenerateTasks
+	StatusTaskNumber = 2
+
+	// CheckoutTaskNumber number of generated order checkouts for GenerateTasks
+	CheckoutTaskNumber = 3
+
+	// DuplicateTaskNumber number of generated orders reusing an already generated OrderID for GenerateTasks
+	DuplicateTaskNumber = 1
+
+	// UpdateTaskNumber number of generated order edits for GenerateTasks
+	UpdateTaskNumber = 2
+
+	// MoveTaskNumber number of generated order moves and swaps for GenerateTasks
+	MoveTaskNumber = 2
+
+	// PrepareTaskNumber number of generated kitchen pulls of the next order to prepare for GenerateTasks
+	PrepareTaskNumber = 2
+
 	// IngredientTaskNumber number of generated ingredients for GenerateTasks
 	IngredientTaskNumber = 6
 
+	// RemoveIngTaskNumber number of generated ingredient removals for GenerateTasks
+	RemoveIngTaskNumber = 2
+
 	// NumberOfWorkersForFunOut for fanout
 	NumberOfWorkersForFunOut = 5
+
+	// FanOutBufferSize capacity of every fanout output channel
+	FanOutBufferSize = 2
+
+	// TaskStuckAfter in milliseconds after which a task without progress is reported as stuck or lost
+	TaskStuckAfter = 2000
+
+	// IngredientBatchSize number of ingredients inserted into the tree at once by the windowed pipeline
+	IngredientBatchSize = 3
+
+	// OrderStatsWindow in milliseconds over which orders per planet are counted
+	OrderStatsWindow = 1000
+
+	// PromotionsFile JSON or YAML (.yaml, .yml) rule set of the promotions engine, relative to the repository root
+	PromotionsFile = "config/promotions.json"
+
+	// EventBufferSize capacity of the kitchen display subscription in the event feed simulation
+	EventBufferSize = 3
+
+	// EventOrderNumber number of orders placed by the event feed simulation
+	EventOrderNumber = 8
+
+	// MaxOrderPriority highest priority of generated orders
+	MaxOrderPriority = 2
+
+	// VIPOrderPercent share of generated orders that are VIP
+	VIPOrderPercent = 20
+
+	// MaxOrderDeadline in minutes from placement of generated order deadlines
+	MaxOrderDeadline = 60
+
+	// OrderTTL in milliseconds a placed order may wait for the kitchen before it expires
+	OrderTTL = 10000
+
+	// ReaperInterval in milliseconds between two expiry runs of the order reaper
+	ReaperInterval = 500
+
+	// ExpiredOrderAction what the reaper does with expired orders: "cancel" or "remove"
+	ExpiredOrderAction = "cancel"
+
+	// StorageBackend where orders and ingredients live: "memory", "sharded" (memory, orders split over OrderShardNumber locks) or "file"
+	StorageBackend = "sharded"
+
+	// OrderShardNumber number of shards of the order list with the "sharded" storage backend
+	OrderShardNumber = 32
+
+	// PersistenceEnabled journals the memory backend to a write-ahead log so its state survives restarts
+	PersistenceEnabled = true
+
+	// PersistenceDir directory of the write-ahead log, the snapshot and the file backend, relative to the repository root
+	PersistenceDir = "data"
+
+	// SnapshotInterval in milliseconds between compacted snapshots
+	SnapshotInterval = 5000
+
+	// WALSyncInterval in milliseconds between fsyncs of the write-ahead log
+	WALSyncInterval = 200
 )
+
+// PlanetOrderTTL per-planet overrides of OrderTTL in milliseconds, far planets get more time
+var PlanetOrderTTL = map[string]int{
+	"Pluto":            20000,
+	"Andromeda Nebula": 30000,
+}
@@ -2,6 +2,9 @@ module github.com/gleb-korostelev/CosmicPizza.git
 
 go 1.23.0
 
-require go.uber.org/zap v1.27.0
+require (
+	go.uber.org/zap v1.27.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require go.uber.org/multierr v1.10.0 // indirect
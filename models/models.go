@@ -1,18 +1,285 @@
 package models
 
+import (
+	"fmt"
+	"time"
+)
+
+// OrderStatus is the lifecycle state of an order
+type OrderStatus int
+
+// Order lifecycle states
+const (
+	StatusPlaced OrderStatus = iota
+	StatusPreparing
+	StatusBaking
+	StatusOutForDelivery
+	StatusDelivered
+	StatusCancelled
+)
+
+func (s OrderStatus) String() string {
+	switch s {
+	case StatusPlaced:
+		return "Placed"
+	case StatusPreparing:
+		return "Preparing"
+	case StatusBaking:
+		return "Baking"
+	case StatusOutForDelivery:
+		return "OutForDelivery"
+	case StatusDelivered:
+		return "Delivered"
+	case StatusCancelled:
+		return "Cancelled"
+	}
+	return "Unknown"
+}
+
+// StatusChange records when an order entered a status
+type StatusChange struct {
+	Status OrderStatus
+	At     time.Time
+}
+
+// PizzaSize is the size of a pizza in a line item
+type PizzaSize string
+
+// Pizza sizes
+const (
+	SizeSmall    PizzaSize = "Small"
+	SizeMedium   PizzaSize = "Medium"
+	SizeLarge    PizzaSize = "Large"
+	SizeGalactic PizzaSize = "Galactic"
+)
+
+// LineItem is a single pizza line of an order
+type LineItem struct {
+	PizzaType string
+	Size      PizzaSize
+	Quantity  int
+	Toppings  []string // Extra toppings from the ingredient catalog
+}
+
+// Money is an exact amount of money in cents
+type Money int64
+
+func (m Money) String() string {
+	sign := ""
+	if m < 0 {
+		sign, m = "-", -m
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, m/100, m%100)
+}
+
+// ReceiptLine is a priced line of a receipt
+type ReceiptLine struct {
+	Item        int // Index of the order line item the line belongs to
+	Description string
+	Quantity    int
+	UnitPrice   Money
+	Amount      Money // UnitPrice times Quantity
+}
+
+// Discount is a reduction applied to an order total
+type Discount struct {
+	Code   string // Promo code or rule that granted the discount
+	Reason string
+	Amount Money
+}
+
+// Receipt is the itemized price of an order
+type Receipt struct {
+	Lines       []ReceiptLine
+	Subtotal    Money
+	Discounts   []Discount
+	DeliveryFee Money
+	Tax         Money
+	Total       Money
+	PromoCode   string
+	IssuedAt    time.Time
+}
+
 // Order represents a pizza order
 type Order struct {
 	OrderID   int
 	Planet    string
-	PizzaType string
+	PizzaType string     // Pizza type of the first line item
+	Items     []LineItem // Every pizza of the order
+	Status    OrderStatus
+	History   []StatusChange // Every status the order went through, oldest first
+	Receipt   *Receipt       // Set at checkout
+	Priority  int            // Higher priorities are prepared first
+	VIP       bool           // VIP orders are prepared before any other order
+	Deadline  time.Time      // SLA deadline, zero if the order has none
+	Version   int            // Copy number among orders kept with the same OrderID, starting at 1
+	Revision  int            // Number of edits of the order content, starting at 1, used for optimistic updates
+	ExpiresAt time.Time      // When the order is expired if it is still placed, zero if it never expires
 	Next      *Order
+	Prev      *Order
 }
 
-// Task represents a unit of work (order or ingredient operation)
+// OrderEventType is the kind of change an order event reports
+type OrderEventType int
+
+// Order event types
+const (
+	EventOrderAdded OrderEventType = iota
+	EventOrderInserted
+	EventOrderRemoved
+	EventStatusChanged
+	EventCheckedOut
+	EventOrdersReset
+	EventOrderUpdated
+	EventOrderMoved
+	EventOrderExpired
+)
+
+func (t OrderEventType) String() string {
+	switch t {
+	case EventOrderAdded:
+		return "Added"
+	case EventOrderInserted:
+		return "Inserted"
+	case EventOrderRemoved:
+		return "Removed"
+	case EventStatusChanged:
+		return "StatusChanged"
+	case EventCheckedOut:
+		return "CheckedOut"
+	case EventOrdersReset:
+		return "Reset"
+	case EventOrderUpdated:
+		return "Updated"
+	case EventOrderMoved:
+		return "Moved"
+	case EventOrderExpired:
+		return "Expired"
+	}
+	return "Unknown"
+}
+
+// OrderEvent describes a single change of the order list
+type OrderEvent struct {
+	Seq     uint64 // Position in the event feed, starting at 1 and without gaps
+	Type    OrderEventType
+	OrderID int
+	Order   Order       // State after the change, or before it for removals; empty for resets
+	From    OrderStatus // Previous status for status changes and expirations
+	At      time.Time
+	Dropped uint64 // Events missed by the subscriber right before this one
+}
+
+// AuditAction is the kind of change recorded in the audit trail
+type AuditAction int
+
+// Audit actions
+const (
+	AuditAdded AuditAction = iota
+	AuditInserted
+	AuditRemoved
+	AuditReverted
+	AuditUpdated
+	AuditMoved
+)
+
+func (a AuditAction) String() string {
+	switch a {
+	case AuditAdded:
+		return "Added"
+	case AuditInserted:
+		return "Inserted"
+	case AuditRemoved:
+		return "Removed"
+	case AuditReverted:
+		return "Reverted"
+	case AuditUpdated:
+		return "Updated"
+	case AuditMoved:
+		return "Moved"
+	}
+	return "Unknown"
+}
+
+// AuditEntry records who changed an order, when, and the order before and after the change
+type AuditEntry struct {
+	Seq         uint64 // Position in the audit trail, starting at 1
+	Action      AuditAction
+	OrderID     int
+	Actor       string
+	At          time.Time
+	Before      *Order // Nil when the order did not exist before the change
+	After       *Order // Nil when the order does not exist after the change
+	PrevOrderID int    // Order right before the removed or moved one, used to put it back on undo
+	HasPrev     bool   // False when the removed or moved order was the head of the list
+	Undone      bool   // Set once the change has been reverted
+	Reverts     uint64 // Seq of the entry a revert undid
+}
+
+// OrderPatch is an edit of an order. Empty fields are left unchanged
+type OrderPatch struct {
+	Planet    string
+	PizzaType string // Replaces the pizza type of the first line item
+	Revision  int    // Revision the edit was based on. Zero skips the check, so the edit may overwrite a concurrent one
+}
+
+// Task represents a unit of work (order or ingredient operation).
+// Fields used by a single kind of task are grouped in the embedded payloads, which are left zero
+// by the other kinds. The payloads are flattened in JSON, so journaled tasks keep their format,
+// and their empty fields other than times are left out.
 type Task struct {
-	Type       int // Task type (Add, Remove, Insert, Search)
-	OrderID    int // Used for order operations
-	Planet     string
-	PizzaType  string
-	Ingredient int // Used for ingredient operations
+	Type       int         // Task type (Add, Remove, Insert, Search)
+	OrderID    int         // Used for order operations
+	Ingredient int         // Used for ingredient operations
+	Status     OrderStatus // Target status for status transitions
+	Actor      string      // Who requested the task, recorded in the audit trail
+
+	OrderPayload    // Added and updated orders
+	ReorderPayload  // Moved and swapped orders
+	CheckoutPayload // Checkouts
+	ExpiryPayload   // Expiry runs
+	RevertPayload   // Undo and revert tasks
+
+	ID         string    // Unique task identifier
+	Seq        uint64    // Sequence number in generation order
+	CreatedAt  time.Time // When the task was generated
+	EnqueuedAt time.Time // When the task was handed to the fan-out
+	StartedAt  time.Time // When a worker started processing the task
+	FinishedAt time.Time // When a worker finished processing the task
+}
+
+// OrderPayload is the content of added orders and the edit of updated ones
+type OrderPayload struct {
+	Planet    string     `json:",omitempty"`
+	PizzaType string     `json:",omitempty"`
+	Items     []LineItem `json:",omitempty"` // Line items of multi-item orders
+	Priority  int        `json:",omitempty"` // Priority of added orders
+	VIP       bool       `json:",omitempty"` // VIP flag of added orders
+	Deadline  time.Time  // SLA deadline of added orders
+	ExpiresAt time.Time  // Expiry of added orders, journaled so recovered orders keep it
+	Revision  int        `json:",omitempty"` // Expected revision of updated orders, zero skips the check
+}
+
+// ReorderPayload is the target of moved and swapped orders
+type ReorderPayload struct {
+	Index    int `json:",omitempty"` // Target position of moved orders
+	SwapWith int `json:",omitempty"` // Second OrderID of swaps
+}
+
+// CheckoutPayload is the input and the result of a checkout
+type CheckoutPayload struct {
+	PromoCode string   `json:",omitempty"` // Promo code used at checkout
+	Receipt   *Receipt `json:",omitempty"` // Receipt priced at checkout, journaled so recovery attaches it instead of pricing again
+}
+
+// ExpiryPayload is the result of an expiry run
+type ExpiryPayload struct {
+	OrderIDs []int `json:",omitempty"` // Orders expired by the run, journaled so recovery expires the same ones
+}
+
+// RevertPayload is the input and the result of undo and revert tasks
+type RevertPayload struct {
+	Steps    int       `json:",omitempty"` // Number of changes an undo task reverts
+	RevertTo time.Time // Point in time a revert task brings the orders back to
+	Reverts  []uint64  `json:",omitempty"` // Audit entries reverted by the task, journaled so recovery reverts the same ones
 }
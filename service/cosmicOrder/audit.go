@@ -0,0 +1,337 @@
+package cosmicorder
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+)
+
+// SystemActor is recorded in the audit trail for changes made without an actor.
+const SystemActor = "system"
+
+// defaultAuditLimit is the number of recent audit entries kept.
+const defaultAuditLimit = 10000
+
+// auditTrail records every add, insert, update, move and remove of the list.
+// It keeps the latest limit entries; older ones are dropped and can no longer be undone.
+type auditTrail struct {
+	entries []models.AuditEntry
+	byOrder map[int][]uint64 // byOrder maps every OrderID to the Seqs of its kept entries
+	dropped uint64           // dropped is the number of entries dropped so far, the Seq of entries[0] minus one
+	limit   int              // limit caps the number of kept entries, zero keeps all of them
+}
+
+func newAuditTrail(limit int) auditTrail {
+	return auditTrail{byOrder: make(map[int][]uint64), limit: limit}
+}
+
+// WithAuditLimit sets how many recent audit entries are kept. Zero keeps the whole trail.
+func WithAuditLimit(n int) Option {
+	return func(s *CosmicOrderList) {
+		s.audit.limit = max(n, 0)
+	}
+}
+
+// pos returns the index in entries of the entry with the given Seq, false if it is not kept.
+func (a *auditTrail) pos(seq uint64) (int, bool) {
+	if seq <= a.dropped || seq > a.dropped+uint64(len(a.entries)) {
+		return 0, false
+	}
+	return int(seq - a.dropped - 1), true
+}
+
+// add appends an entry, numbering it, and drops the oldest entries beyond the limit.
+func (a *auditTrail) add(entry models.AuditEntry) {
+	entry.Seq = a.dropped + uint64(len(a.entries)) + 1
+	a.byOrder[entry.OrderID] = append(a.byOrder[entry.OrderID], entry.Seq)
+	a.entries = append(a.entries, entry)
+
+	for a.limit > 0 && len(a.entries) > a.limit {
+		oldest := a.entries[0]
+		if seqs := a.byOrder[oldest.OrderID][1:]; len(seqs) > 0 {
+			a.byOrder[oldest.OrderID] = seqs
+		} else {
+			delete(a.byOrder, oldest.OrderID)
+		}
+		// Reslicing keeps appends amortized O(1), the dropped prefix is freed on the next reallocation
+		a.entries[0] = models.AuditEntry{}
+		a.entries = a.entries[1:]
+		a.dropped++
+	}
+}
+
+// PlaceOrderAs is PlaceOrder recording actor in the audit trail.
+func (s *CosmicOrderList) PlaceOrderAs(actor string, order models.Order) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.place(actor, "add", models.EventOrderAdded, s.length, order)
+}
+
+// InsertOrderAs is InsertOrder recording actor in the audit trail.
+func (s *CosmicOrderList) InsertOrderAs(actor string, index, orderID int, planet, pizzaType string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.place(actor, "insert", models.EventOrderInserted, index, models.Order{OrderID: orderID, Planet: planet, PizzaType: pizzaType})
+}
+
+// RemoveOrderAs is RemoveOrder recording actor in the audit trail.
+func (s *CosmicOrderList) RemoveOrderAs(actor string, orderID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.remove(actor, orderID)
+}
+
+// AuditTrail returns the audit entries of an order, oldest first.
+func (s *CosmicOrderList) AuditTrail(orderID int) []models.AuditEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seqs := s.audit.byOrder[orderID]
+	entries := make([]models.AuditEntry, len(seqs))
+	for i, seq := range seqs {
+		pos, _ := s.audit.pos(seq)
+		entries[i] = cloneAuditEntry(s.audit.entries[pos])
+	}
+	return entries
+}
+
+// AuditLog returns the kept audit trail, oldest first.
+func (s *CosmicOrderList) AuditLog() []models.AuditEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := make([]models.AuditEntry, len(s.audit.entries))
+	for i, entry := range s.audit.entries {
+		entries[i] = cloneAuditEntry(entry)
+	}
+	return entries
+}
+
+// RestoreAudit replaces the audit trail with entries, e.g. from a snapshot taken with AuditLog.
+// The entries must have consecutive Seqs, oldest first; new entries continue after the last one.
+// Call it after Restore, which clears the trail.
+func (s *CosmicOrderList) RestoreAudit(entries []models.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	audit := newAuditTrail(s.audit.limit)
+	if len(entries) > 0 {
+		audit.dropped = entries[0].Seq - 1
+	}
+	for _, entry := range entries {
+		if next := audit.dropped + uint64(len(audit.entries)) + 1; entry.Seq != next {
+			return fmt.Errorf("restore audit entry %d, expected %d: %w", entry.Seq, next, ErrAuditGap)
+		}
+		audit.add(cloneAuditEntry(entry))
+	}
+	s.audit = audit
+	return nil
+}
+
+// Undo reverts the last n changes that were not reverted yet, newest first, and returns the Seqs
+// of the reverted entries. Every revert is itself recorded in the audit trail with actor.
+// It returns ErrNothingToUndo if there is no change left, and ErrUndoConflict if a later change
+// makes one of the reverts impossible, e.g. the removed order ID was reused; then nothing is reverted.
+func (s *CosmicOrderList) Undo(actor string, n int) ([]uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seqs := s.undoable(func(entry models.AuditEntry, undone int) bool {
+		return undone < n
+	})
+	if len(seqs) == 0 && n > 0 {
+		return nil, fmt.Errorf("undo %d changes: %w", n, ErrNothingToUndo)
+	}
+	return seqs, s.revertAll(actor, seqs)
+}
+
+// RevertTo brings the list back to its state at t by reverting every change made after it, newest first,
+// and returns the Seqs of the reverted entries. Like Undo it reverts all of them or none.
+// Status changes are not reverted: orders that stay in the list keep their current status.
+func (s *CosmicOrderList) RevertTo(actor string, t time.Time) ([]uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seqs := s.undoable(func(entry models.AuditEntry, undone int) bool {
+		return entry.At.After(t)
+	})
+	return seqs, s.revertAll(actor, seqs)
+}
+
+// Revert reverts the audit entries with the given Seqs in the given order, all of them or none.
+// It repeats an earlier Undo or RevertTo, e.g. when a journaled one is replayed.
+func (s *CosmicOrderList) Revert(actor string, seqs []uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.revertAll(actor, seqs)
+}
+
+// undoable walks the audit trail backwards over the changes not reverted yet while keep returns true
+// and returns their Seqs, newest first. keep gets the number of changes taken so far.
+func (s *CosmicOrderList) undoable(keep func(entry models.AuditEntry, undone int) bool) []uint64 {
+	var seqs []uint64
+	for pos := len(s.audit.entries) - 1; pos >= 0; pos-- {
+		entry := s.audit.entries[pos]
+		if entry.Action == models.AuditReverted || entry.Undone {
+			continue
+		}
+		if !keep(entry, len(seqs)) {
+			break
+		}
+		seqs = append(seqs, entry.Seq)
+	}
+	return seqs
+}
+
+// revertAll checks that every entry can be reverted after the ones before it, then reverts them.
+func (s *CosmicOrderList) revertAll(actor string, seqs []uint64) error {
+	if err := s.checkReverts(seqs); err != nil {
+		return err
+	}
+	// Recording the reverts may drop the oldest entries, so they are copied first
+	entries := make([]models.AuditEntry, len(seqs))
+	for i, seq := range seqs {
+		pos, _ := s.audit.pos(seq)
+		entries[i] = s.audit.entries[pos]
+	}
+	for _, entry := range entries {
+		s.revert(actor, entry)
+	}
+	return nil
+}
+
+// checkReverts returns ErrUndoConflict if one of the entries cannot be reverted once the ones
+// before it are. It follows which versions of the orders those earlier reverts take out of the
+// list or put back, as they decide whether the later ones conflict.
+func (s *CosmicOrderList) checkReverts(seqs []uint64) error {
+	type versionKey struct{ orderID, version int }
+	present := make(map[versionKey]bool, s.length)
+	stored := make(map[int]int, len(s.index)) // stored counts the versions of every OrderID in the list
+	for node := s.head; node != nil; node = node.Next {
+		present[versionKey{node.OrderID, node.Version}] = true
+		stored[node.OrderID]++
+	}
+
+	for _, seq := range seqs {
+		pos, ok := s.audit.pos(seq)
+		if !ok {
+			return fmt.Errorf("undo audit entry %d: not in the trail: %w", seq, ErrUndoConflict)
+		}
+		entry := s.audit.entries[pos]
+		if entry.Action == models.AuditReverted || entry.Undone {
+			return fmt.Errorf("undo audit entry %d: already reverted: %w", seq, ErrUndoConflict)
+		}
+
+		switch entry.Action {
+		case models.AuditAdded, models.AuditInserted:
+			key := versionKey{entry.OrderID, entry.After.Version}
+			if !present[key] {
+				return undoConflict(entry, "is gone")
+			}
+			present[key] = false
+			stored[entry.OrderID]--
+		case models.AuditRemoved:
+			key := versionKey{entry.OrderID, entry.Before.Version}
+			if present[key] || (stored[entry.OrderID] > 0 && s.duplicates != DuplicateKeepBoth) {
+				return undoConflict(entry, "was placed again")
+			}
+			present[key] = true
+			stored[entry.OrderID]++
+		case models.AuditUpdated, models.AuditMoved:
+			if !present[versionKey{entry.OrderID, entry.After.Version}] {
+				return undoConflict(entry, "is gone")
+			}
+		}
+	}
+	return nil
+}
+
+// undoConflict returns the ErrUndoConflict of an entry that cannot be reverted.
+func undoConflict(entry models.AuditEntry, reason string) error {
+	return fmt.Errorf("undo audit entry %d: order #%d %s: %w", entry.Seq, entry.OrderID, reason, ErrUndoConflict)
+}
+
+// revert applies the inverse of entry, marks it undone and records the revert.
+// checkReverts must have accepted it.
+func (s *CosmicOrderList) revert(actor string, entry models.AuditEntry) {
+	if pos, ok := s.audit.pos(entry.Seq); ok {
+		s.audit.entries[pos].Undone = true
+	}
+
+	revert := models.AuditEntry{Action: models.AuditReverted, OrderID: entry.OrderID, Actor: actor, Reverts: entry.Seq}
+	switch entry.Action {
+	case models.AuditAdded, models.AuditInserted:
+		node := s.lookup(entry.OrderID, entry.After.Version)
+		before := detach(node)
+		s.unlink(node)
+		s.emit(models.EventOrderRemoved, node, node.Status)
+		revert.Before = &before
+
+	case models.AuditRemoved:
+		restored := detach(entry.Before)
+		node := &restored
+		s.linkAfter(s.revertPosition(entry), node)
+		s.emit(models.EventOrderInserted, node, node.Status)
+		after := detach(node)
+		revert.After = &after
+
+	case models.AuditUpdated:
+		node := s.lookup(entry.OrderID, entry.After.Version)
+		before := detach(node)
+		s.overwrite(node, *entry.Before)
+		s.emit(models.EventOrderUpdated, node, node.Status)
+		after := detach(node)
+		revert.Before, revert.After = &before, &after
+
+	case models.AuditMoved:
+		node := s.lookup(entry.OrderID, entry.After.Version)
+		s.move(node, s.revertPosition(entry))
+		s.queue.reorder(s.head)
+		s.emit(models.EventOrderMoved, node, node.Status)
+		after := detach(node)
+		revert.After = &after
+	}
+
+	s.record(revert)
+}
+
+// revertPosition returns the node a removed or moved order is linked after when it is put back:
+// its former predecessor if still there, the head if it was the head, the tail otherwise.
+func (s *CosmicOrderList) revertPosition(entry models.AuditEntry) *models.Order {
+	if !entry.HasPrev {
+		return nil
+	}
+	if prev, ok := s.index[entry.PrevOrderID]; ok {
+		return prev
+	}
+	return s.tail
+}
+
+// record appends an entry to the audit trail. It must be called with the write lock held.
+func (s *CosmicOrderList) record(entry models.AuditEntry) {
+	if entry.Actor == "" {
+		entry.Actor = SystemActor
+	}
+	if entry.At.IsZero() {
+		entry.At = time.Now()
+	}
+	s.audit.add(entry)
+}
+
+// cloneAuditEntry deep copies the orders of an audit entry.
+func cloneAuditEntry(entry models.AuditEntry) models.AuditEntry {
+	if entry.Before != nil {
+		before := detach(entry.Before)
+		entry.Before = &before
+	}
+	if entry.After != nil {
+		after := detach(entry.After)
+		entry.After = &after
+	}
+	return entry
+}
@@ -0,0 +1,133 @@
+package cosmicorder
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+)
+
+// place adds single-pizza orders with the given IDs to list.
+func place(t *testing.T, list *CosmicOrderList, ids ...int) {
+	t.Helper()
+
+	for _, id := range ids {
+		if err := list.PlaceOrder(models.Order{OrderID: id, Planet: "Mars", PizzaType: "Galactic Cheese"}); err != nil {
+			t.Fatalf("place order #%d: %v", id, err)
+		}
+	}
+}
+
+// listIDs returns the OrderIDs of list in list order.
+func listIDs(list *CosmicOrderList) []int {
+	var ids []int
+	for order := range list.All() {
+		ids = append(ids, order.OrderID)
+	}
+	return ids
+}
+
+func TestRevertIsAllOrNothing(t *testing.T) {
+	list := NewService()
+	place(t, list, 1, 2)                        // Seqs 1 and 2
+	if err := list.RemoveOrder(1); err != nil { // Seq 3
+		t.Fatalf("RemoveOrder: %v", err)
+	}
+	place(t, list, 1) // Seq 4 reuses the removed ID
+
+	// Taking order #2 out again works, but putting the removed order #1 back conflicts with Seq 4
+	err := list.Revert("manager", []uint64{2, 3})
+	if !errors.Is(err, ErrUndoConflict) {
+		t.Fatalf("Revert: got %v, want ErrUndoConflict", err)
+	}
+	if got, want := listIDs(list), []int{2, 1}; !slices.Equal(got, want) {
+		t.Errorf("list after failed revert = %v, want %v", got, want)
+	}
+	for _, entry := range list.AuditLog() {
+		if entry.Undone || entry.Action == models.AuditReverted {
+			t.Errorf("failed revert left audit entry %d (%s, undone %v)", entry.Seq, entry.Action, entry.Undone)
+		}
+	}
+}
+
+func TestRevertFollowsEarlierReverts(t *testing.T) {
+	list := NewService()
+	place(t, list, 1)                           // Seq 1
+	if err := list.RemoveOrder(1); err != nil { // Seq 2
+		t.Fatalf("RemoveOrder: %v", err)
+	}
+	place(t, list, 1) // Seq 3
+
+	// Each revert is only possible after the one before it
+	seqs, err := list.Undo("manager", 3)
+	if err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	if want := []uint64{3, 2, 1}; !slices.Equal(seqs, want) {
+		t.Errorf("Undo reverted %v, want %v", seqs, want)
+	}
+	if list.Len() != 0 {
+		t.Errorf("list holds %v after undoing everything", listIDs(list))
+	}
+}
+
+func TestAuditLimit(t *testing.T) {
+	list := NewService(WithAuditLimit(3))
+	place(t, list, 1, 2, 3, 4, 5)
+
+	log := list.AuditLog()
+	if len(log) != 3 || log[0].Seq != 3 || log[2].Seq != 5 {
+		t.Fatalf("audit log holds Seqs %v, want 3..5", auditSeqs(log))
+	}
+	if trail := list.AuditTrail(1); len(trail) != 0 {
+		t.Errorf("dropped entries of order #1 are still in its trail: %v", auditSeqs(trail))
+	}
+
+	seqs, err := list.Undo("manager", 5)
+	if err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	if want := []uint64{5, 4, 3}; !slices.Equal(seqs, want) {
+		t.Errorf("Undo reverted %v, want the kept entries %v", seqs, want)
+	}
+	if got, want := listIDs(list), []int{1, 2}; !slices.Equal(got, want) {
+		t.Errorf("list after undo = %v, want %v", got, want)
+	}
+	if err := list.Revert("manager", []uint64{1}); !errors.Is(err, ErrUndoConflict) {
+		t.Errorf("reverting a dropped entry: got %v, want ErrUndoConflict", err)
+	}
+}
+
+func TestRestoreAudit(t *testing.T) {
+	list := NewService()
+	place(t, list, 1, 2)
+	orders, log := list.Snapshot(), list.AuditLog()
+
+	restored := NewService()
+	if err := restored.Restore(orders); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if err := restored.RestoreAudit(log); err != nil {
+		t.Fatalf("RestoreAudit: %v", err)
+	}
+	seqs, err := restored.Undo("manager", 1)
+	if err != nil || !slices.Equal(seqs, []uint64{2}) {
+		t.Fatalf("Undo after restore = %v, %v; want [2]", seqs, err)
+	}
+	if got := restored.AuditLog(); got[len(got)-1].Seq != 3 {
+		t.Errorf("new entries continue at Seq %d, want 3", got[len(got)-1].Seq)
+	}
+
+	if err := restored.RestoreAudit([]models.AuditEntry{log[0], {Seq: 5}}); !errors.Is(err, ErrAuditGap) {
+		t.Errorf("RestoreAudit with a gap: got %v, want ErrAuditGap", err)
+	}
+}
+
+func auditSeqs(entries []models.AuditEntry) []uint64 {
+	seqs := make([]uint64, len(entries))
+	for i, entry := range entries {
+		seqs[i] = entry.Seq
+	}
+	return seqs
+}
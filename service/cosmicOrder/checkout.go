@@ -0,0 +1,77 @@
+package cosmicorder
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+)
+
+// Pricer prices an order and returns its itemized receipt.
+type Pricer interface {
+	Quote(order models.Order, promoCode string) (models.Receipt, error)
+}
+
+// checkoutStatuses are the statuses in which an order can be checked out.
+var checkoutStatuses = []models.OrderStatus{models.StatusPlaced, models.StatusPreparing, models.StatusBaking}
+
+// WithPricer sets the pricer used at checkout.
+func WithPricer(p Pricer) Option {
+	return func(s *CosmicOrderList) {
+		s.pricer = p
+	}
+}
+
+// Checkout prices the order with the optional promo code and attaches the receipt to it.
+// Checking out again replaces the previous receipt. Only orders that have not left the kitchen
+// can be checked out; other orders, including expired ones, return ErrCheckoutClosed.
+func (s *CosmicOrderList) Checkout(orderID int, promoCode string) (models.Receipt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	node, ok := s.index[orderID]
+	if !ok {
+		return models.Receipt{}, fmt.Errorf("checkout order #%d: %w", orderID, ErrOrderNotFound)
+	}
+	if !slices.Contains(checkoutStatuses, node.Status) {
+		return models.Receipt{}, fmt.Errorf("checkout order #%d %s: %w", orderID, node.Status, ErrCheckoutClosed)
+	}
+	if s.pricer == nil {
+		return models.Receipt{}, fmt.Errorf("checkout order #%d: %w", orderID, ErrNoPricer)
+	}
+
+	receipt, err := s.pricer.Quote(detach(node), promoCode)
+	if err != nil {
+		return models.Receipt{}, fmt.Errorf("checkout order #%d: %w", orderID, err)
+	}
+	node.Receipt = cloneReceipt(&receipt)
+	s.emit(models.EventCheckedOut, node, node.Status)
+	return receipt, nil
+}
+
+// AttachReceipt attaches a receipt priced earlier to the order without pricing it again,
+// e.g. when a journaled checkout is replayed. It replaces the previous receipt and does not
+// check the status, as the replayed checkout was accepted when it was journaled.
+func (s *CosmicOrderList) AttachReceipt(orderID int, receipt models.Receipt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	node, ok := s.index[orderID]
+	if !ok {
+		return fmt.Errorf("attach receipt to order #%d: %w", orderID, ErrOrderNotFound)
+	}
+	node.Receipt = cloneReceipt(&receipt)
+	s.emit(models.EventCheckedOut, node, node.Status)
+	return nil
+}
+
+// cloneReceipt deep copies a receipt.
+func cloneReceipt(receipt *models.Receipt) *models.Receipt {
+	if receipt == nil {
+		return nil
+	}
+	cloned := *receipt
+	cloned.Lines = slices.Clone(receipt.Lines)
+	cloned.Discounts = slices.Clone(receipt.Discounts)
+	return &cloned
+}
@@ -0,0 +1,59 @@
+package cosmicorder
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+	"github.com/gleb-korostelev/CosmicPizza.git/service/pricing"
+)
+
+func TestCheckoutStatus(t *testing.T) {
+	tests := []struct {
+		name  string
+		path  []models.OrderStatus // path is the status changes made before the checkout
+		ttl   bool                 // ttl expires the order before the checkout
+		allow bool
+	}{
+		{name: "placed", allow: true},
+		{name: "preparing", path: []models.OrderStatus{models.StatusPreparing}, allow: true},
+		{name: "baking", path: []models.OrderStatus{models.StatusPreparing, models.StatusBaking}, allow: true},
+		{name: "out for delivery", path: []models.OrderStatus{models.StatusPreparing, models.StatusBaking, models.StatusOutForDelivery}},
+		{name: "delivered", path: []models.OrderStatus{models.StatusPreparing, models.StatusBaking, models.StatusOutForDelivery, models.StatusDelivered}},
+		{name: "cancelled", path: []models.OrderStatus{models.StatusCancelled}},
+		{name: "expired", ttl: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list := NewService(WithPricer(pricing.Default()), WithTTL(TTLPolicy{Default: time.Minute}))
+			if err := list.PlaceOrder(models.Order{OrderID: 1, Planet: "Mars", PizzaType: "Galactic Cheese"}); err != nil {
+				t.Fatalf("PlaceOrder: %v", err)
+			}
+			for _, status := range tt.path {
+				if err := list.Advance(1, status); err != nil {
+					t.Fatalf("Advance(%s): %v", status, err)
+				}
+			}
+			if tt.ttl {
+				if expired, _ := list.Expire(time.Now().Add(time.Hour)); len(expired) != 1 {
+					t.Fatalf("Expire expired %d orders, want 1", len(expired))
+				}
+			}
+
+			_, err := list.Checkout(1, "")
+			if tt.allow {
+				if err != nil {
+					t.Fatalf("Checkout: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrCheckoutClosed) {
+				t.Fatalf("Checkout: got %v, want ErrCheckoutClosed", err)
+			}
+			if order, _ := list.Get(1); order.Receipt != nil {
+				t.Errorf("refused checkout attached a receipt")
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package cosmicorder
+
+import (
+	"slices"
+	"sync/atomic"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+)
+
+// DuplicatePolicy decides what happens when an order is placed with an OrderID that is already stored.
+type DuplicatePolicy int
+
+const (
+	// DuplicateReject refuses the new order with ErrDuplicateOrder.
+	DuplicateReject DuplicatePolicy = iota
+	// DuplicateUpsert replaces the planet, items, priority, VIP flag and deadline of the stored order
+	// in place. Its status and history are kept and its receipt is dropped, as the price changed.
+	DuplicateUpsert
+	// DuplicateKeepBoth stores the new order next to the old one with the next Version.
+	// Lookups by ID reach the latest version; removing it makes the previous one current again.
+	DuplicateKeepBoth
+)
+
+// WithDuplicatePolicy sets how orders with an already stored OrderID are handled. The default is DuplicateReject.
+func WithDuplicatePolicy(policy DuplicatePolicy) Option {
+	return func(s *CosmicOrderList) {
+		s.duplicates = policy
+	}
+}
+
+// WithIDAllocator makes the list report every stored OrderID to ids, so IDs it hands out
+// later never collide with orders placed with explicit IDs or restored from a snapshot.
+func WithIDAllocator(ids *IDAllocator) Option {
+	return func(s *CosmicOrderList) {
+		s.ids = ids
+	}
+}
+
+// IDAllocator hands out increasing order IDs, safe for concurrent use.
+type IDAllocator struct {
+	last atomic.Int64
+}
+
+// NewIDAllocator creates an allocator whose first ID is start+1.
+func NewIDAllocator(start int) *IDAllocator {
+	a := &IDAllocator{}
+	a.last.Store(int64(start))
+	return a
+}
+
+// Next returns a new ID, greater than every ID handed out or observed before.
+func (a *IDAllocator) Next() int {
+	return int(a.last.Add(1))
+}
+
+// Observe records an ID allocated elsewhere so Next never returns it or anything below it.
+func (a *IDAllocator) Observe(id int) {
+	for {
+		last := a.last.Load()
+		if int64(id) <= last || a.last.CompareAndSwap(last, int64(id)) {
+			return
+		}
+	}
+}
+
+// Versions returns every stored version of an order, oldest first.
+func (s *CosmicOrderList) Versions(orderID int) []models.Order {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	current, ok := s.index[orderID]
+	if !ok {
+		return []models.Order{}
+	}
+	versions := make([]models.Order, 0, len(s.versions[orderID])+1)
+	for _, node := range s.versions[orderID] {
+		versions = append(versions, detach(node))
+	}
+	return append(versions, detach(current))
+}
+
+// upsert overwrites the stored order with the content of order and records the change made by actor.
+func (s *CosmicOrderList) upsert(actor string, node *models.Order, order models.Order) error {
+	fresh, err := s.newOrder(order)
+	if err != nil {
+		return err
+	}
+
+	before := detach(node)
+	s.overwrite(node, *fresh)
+	s.emit(models.EventOrderUpdated, node, node.Status)
+
+	after := detach(node)
+	s.record(models.AuditEntry{Action: models.AuditUpdated, OrderID: node.OrderID, Actor: actor, Before: &before, After: &after})
+	return nil
+}
+
+// overwrite copies the content of from into node, bumps its revision and keeps the indexes
+// and the kitchen queue up to date.
+func (s *CosmicOrderList) overwrite(node *models.Order, from models.Order) {
+	s.unindexNode(node)
+	node.Planet = from.Planet
+	node.PizzaType = from.PizzaType
+	node.Items = cloneItems(from.Items)
+	node.Priority = from.Priority
+	node.VIP = from.VIP
+	node.Deadline = from.Deadline
+	node.ExpiresAt = from.ExpiresAt
+	node.Receipt = cloneReceipt(from.Receipt)
+	node.Revision++
+	s.indexNode(node)
+	s.queue.requeue(node)
+}
+
+// lookup returns the node of a specific version of an order.
+func (s *CosmicOrderList) lookup(orderID, version int) *models.Order {
+	if current, ok := s.index[orderID]; ok && current.Version == version {
+		return current
+	}
+	for _, node := range s.versions[orderID] {
+		if node.Version == version {
+			return node
+		}
+	}
+	return nil
+}
+
+// indexID makes the node reachable by its OrderID. The highest version is the current one.
+func (s *CosmicOrderList) indexID(node *models.Order) {
+	if s.ids != nil {
+		s.ids.Observe(node.OrderID)
+	}
+
+	current, ok := s.index[node.OrderID]
+	if !ok {
+		s.index[node.OrderID] = node
+		return
+	}
+	if node.Version > current.Version {
+		s.index[node.OrderID] = node
+		node = current
+	}
+
+	older := s.versions[node.OrderID]
+	i, _ := slices.BinarySearchFunc(older, node.Version, func(n *models.Order, version int) int { return n.Version - version })
+	s.versions[node.OrderID] = slices.Insert(older, i, node)
+}
+
+// unindexID removes the node from the ID index. Removing the current version makes the previous one current.
+func (s *CosmicOrderList) unindexID(node *models.Order) {
+	older := s.versions[node.OrderID]
+	if s.index[node.OrderID] == node {
+		if len(older) == 0 {
+			delete(s.index, node.OrderID)
+			return
+		}
+		s.index[node.OrderID] = older[len(older)-1]
+		older = older[:len(older)-1]
+	} else {
+		older = slices.DeleteFunc(older, func(n *models.Order) bool { return n == node })
+	}
+
+	if len(older) == 0 {
+		delete(s.versions, node.OrderID)
+		return
+	}
+	s.versions[node.OrderID] = older
+}
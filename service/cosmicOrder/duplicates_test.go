@@ -0,0 +1,140 @@
+package cosmicorder
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+)
+
+var (
+	firstOrder  = models.Order{OrderID: 1, Planet: "Mars", PizzaType: "Galactic Cheese"}
+	secondOrder = models.Order{OrderID: 1, Planet: "Venus", PizzaType: "Nebula Deluxe", Priority: 1}
+)
+
+func TestDuplicateReject(t *testing.T) {
+	list := NewService()
+	if err := list.PlaceOrder(firstOrder); err != nil {
+		t.Fatalf("place the first order: %v", err)
+	}
+	if err := list.PlaceOrder(secondOrder); !errors.Is(err, ErrDuplicateOrder) {
+		t.Fatalf("place the duplicate: err = %v, want %v", err, ErrDuplicateOrder)
+	}
+
+	order, _ := list.Get(1)
+	if order.Planet != "Mars" || order.Revision != 1 || list.Len() != 1 {
+		t.Errorf("refused duplicate changed the list: %+v, length %d", order, list.Len())
+	}
+}
+
+func TestDuplicateUpsert(t *testing.T) {
+	list := NewService(WithDuplicatePolicy(DuplicateUpsert))
+	if err := list.PlaceOrder(firstOrder); err != nil {
+		t.Fatalf("place the first order: %v", err)
+	}
+	if err := list.Advance(1, models.StatusPreparing); err != nil {
+		t.Fatalf("advance: %v", err)
+	}
+	if err := list.AttachReceipt(1, models.Receipt{Total: 1000}); err != nil {
+		t.Fatalf("attach receipt: %v", err)
+	}
+	if err := list.PlaceOrder(secondOrder); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+
+	order, _ := list.Get(1)
+	if order.Planet != "Venus" || order.PizzaType != "Nebula Deluxe" || order.Priority != 1 {
+		t.Errorf("upsert did not replace the content: %+v", order)
+	}
+	if order.Revision != 2 || order.Version != 1 {
+		t.Errorf("revision %d version %d, want revision 2 version 1", order.Revision, order.Version)
+	}
+	if order.Status != models.StatusPreparing || len(order.History) != 2 {
+		t.Errorf("upsert lost the status: %s with %d history entries", order.Status, len(order.History))
+	}
+	if order.Receipt != nil {
+		t.Errorf("upsert kept the receipt of the old content: %+v", order.Receipt)
+	}
+	if list.Len() != 1 || len(list.Versions(1)) != 1 {
+		t.Errorf("upsert stored a second order: length %d, %d versions", list.Len(), len(list.Versions(1)))
+	}
+	if mars, venus := list.Count(ByPlanet("Mars")), list.Count(ByPlanet("Venus")); mars != 0 || venus != 1 {
+		t.Errorf("planet index: Mars %d Venus %d, want 0 and 1", mars, venus)
+	}
+}
+
+func TestDuplicateKeepBoth(t *testing.T) {
+	list := NewService(WithDuplicatePolicy(DuplicateKeepBoth))
+	for _, order := range []models.Order{firstOrder, secondOrder} {
+		if err := list.PlaceOrder(order); err != nil {
+			t.Fatalf("place %s: %v", order.Planet, err)
+		}
+	}
+
+	versions := list.Versions(1)
+	if len(versions) != 2 || versions[0].Version != 1 || versions[1].Version != 2 {
+		t.Fatalf("Versions = %+v, want versions 1 and 2", versions)
+	}
+	if versions[0].Planet != "Mars" || versions[1].Planet != "Venus" {
+		t.Errorf("versions hold %s and %s, want Mars and Venus", versions[0].Planet, versions[1].Planet)
+	}
+	if current, _ := list.Get(1); current.Version != 2 {
+		t.Errorf("Get returned version %d, want the latest", current.Version)
+	}
+	if list.Len() != 2 {
+		t.Errorf("Len = %d, want 2", list.Len())
+	}
+
+	// Removing the latest version makes the previous one current again
+	if err := list.RemoveOrder(1); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if current, ok := list.Get(1); !ok || current.Version != 1 || current.Planet != "Mars" {
+		t.Errorf("after removing the latest, Get = %+v, %v; want version 1 on Mars", current, ok)
+	}
+	if err := list.RemoveOrder(1); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if _, ok := list.Get(1); ok || len(list.Versions(1)) != 0 {
+		t.Error("order #1 still stored after removing both versions")
+	}
+}
+
+func TestIDAllocatorObserve(t *testing.T) {
+	const goroutines = 64
+
+	ids := NewIDAllocator(0)
+	list := NewService(WithIDAllocator(ids))
+
+	// Half the goroutines draw IDs, the other half place orders with explicit IDs the allocator only observes.
+	// Explicit IDs are far enough apart that drawn IDs never reach the next one.
+	var wg sync.WaitGroup
+	for i := range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id := ids.Next()
+			if i%2 == 1 {
+				id = 1000 * i
+			}
+			if err := list.PlaceOrder(models.Order{OrderID: id, Planet: "Pluto", PizzaType: "Galactic Cheese"}); err != nil {
+				t.Errorf("place order #%d: %v", id, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if list.Len() != goroutines {
+		t.Errorf("Len = %d, want %d", list.Len(), goroutines)
+	}
+	if next := ids.Next(); next <= 1000*(goroutines-1) {
+		t.Errorf("Next = %d, want above every observed ID", next)
+	}
+
+	// Observing a smaller ID never moves the allocator back
+	ids.Observe(1)
+	if next := ids.Next(); next <= 1000*(goroutines-1) {
+		t.Errorf("Next = %d after observing a smaller ID", next)
+	}
+}
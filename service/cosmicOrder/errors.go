@@ -0,0 +1,60 @@
+package cosmicorder
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+)
+
+// Errors returned by the order list.
+var (
+	// ErrOrderNotFound is returned when no order has the requested ID.
+	ErrOrderNotFound = errors.New("order not found")
+
+	// ErrDuplicateOrder is returned when an order with the same ID is already stored.
+	ErrDuplicateOrder = errors.New("duplicate order")
+
+	// ErrIndexOutOfRange is returned when an order is inserted past the end of the list.
+	ErrIndexOutOfRange = errors.New("index out of range")
+
+	// ErrNoPricer is returned by Checkout when the list has no pricer.
+	ErrNoPricer = errors.New("no pricer configured")
+
+	// ErrCheckoutClosed is returned by Checkout when the order is out for delivery, delivered or cancelled.
+	ErrCheckoutClosed = errors.New("order can no longer be checked out")
+
+	// ErrNothingToPrepare is returned by NextToPrepare when no placed order waits in the kitchen queue.
+	ErrNothingToPrepare = errors.New("no order to prepare")
+
+	// ErrRevisionConflict is returned when an order was edited since the revision an update was based on.
+	ErrRevisionConflict = errors.New("order revision conflict")
+
+	// ErrNothingToUndo is returned by Undo when every change was already reverted.
+	ErrNothingToUndo = errors.New("nothing to undo")
+
+	// ErrUndoConflict is returned when a later change makes a revert impossible.
+	ErrUndoConflict = errors.New("undo conflicts with a later change")
+
+	// ErrAuditGap is returned by RestoreAudit when the Seqs of the entries are not consecutive.
+	ErrAuditGap = errors.New("audit entries are not consecutive")
+)
+
+// ErrIllegalTransition is matched by every TransitionError.
+var ErrIllegalTransition = errors.New("illegal status transition")
+
+// TransitionError reports a status change that the lifecycle does not allow.
+type TransitionError struct {
+	OrderID int
+	From    models.OrderStatus
+	To      models.OrderStatus
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("order #%d: cannot move from %s to %s", e.OrderID, e.From, e.To)
+}
+
+// Unwrap lets errors.Is match ErrIllegalTransition.
+func (e *TransitionError) Unwrap() error {
+	return ErrIllegalTransition
+}
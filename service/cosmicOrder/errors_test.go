@@ -0,0 +1,118 @@
+package cosmicorder
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+	"github.com/gleb-korostelev/CosmicPizza.git/service/pricing"
+)
+
+func TestErrors(t *testing.T) {
+	ignore := func(_ any, err error) error { return err }
+	tests := []struct {
+		name    string
+		opts    []Option
+		call    func(list *CosmicOrderList) error
+		wantErr error
+	}{
+		{name: "remove unknown order", call: func(l *CosmicOrderList) error { return l.RemoveOrder(42) }, wantErr: ErrOrderNotFound},
+		{name: "advance unknown order", call: func(l *CosmicOrderList) error { return l.Advance(42, models.StatusPreparing) }, wantErr: ErrOrderNotFound},
+		{name: "update unknown order", call: func(l *CosmicOrderList) error { return ignore(l.UpdateOrder(42, models.OrderPatch{Planet: "Venus"})) }, wantErr: ErrOrderNotFound},
+		{name: "move unknown order", call: func(l *CosmicOrderList) error { return l.MoveOrder(42, 0) }, wantErr: ErrOrderNotFound},
+		{name: "swap with unknown order", call: func(l *CosmicOrderList) error { return l.Swap(1, 42) }, wantErr: ErrOrderNotFound},
+		{name: "check out unknown order", call: func(l *CosmicOrderList) error { return ignore(l.Checkout(42, "")) }, wantErr: ErrOrderNotFound},
+		{name: "attach receipt to unknown order", call: func(l *CosmicOrderList) error { return l.AttachReceipt(42, models.Receipt{}) }, wantErr: ErrOrderNotFound},
+		{name: "place duplicate", call: func(l *CosmicOrderList) error {
+			return l.PlaceOrder(models.Order{OrderID: 1, Planet: "Venus", PizzaType: "Galactic Cheese"})
+		}, wantErr: ErrDuplicateOrder},
+		{name: "insert duplicate", call: func(l *CosmicOrderList) error { return l.InsertOrder(0, 2, "Venus", "Galactic Cheese") }, wantErr: ErrDuplicateOrder},
+		{name: "insert before the list", call: func(l *CosmicOrderList) error { return l.InsertOrder(-1, 3, "Venus", "Galactic Cheese") }, wantErr: ErrIndexOutOfRange},
+		{name: "insert past the list", call: func(l *CosmicOrderList) error { return l.InsertOrder(3, 3, "Venus", "Galactic Cheese") }, wantErr: ErrIndexOutOfRange},
+		{name: "move past the list", call: func(l *CosmicOrderList) error { return l.MoveOrder(1, 2) }, wantErr: ErrIndexOutOfRange},
+		{name: "check out without pricer", opts: []Option{WithPricer(nil)}, call: func(l *CosmicOrderList) error { return ignore(l.Checkout(1, "")) }, wantErr: ErrNoPricer},
+		{
+			name: "check out cancelled order",
+			call: func(l *CosmicOrderList) error {
+				if err := l.Advance(1, models.StatusCancelled); err != nil {
+					return err
+				}
+				return ignore(l.Checkout(1, ""))
+			},
+			wantErr: ErrCheckoutClosed,
+		},
+		{
+			name: "prepare from an empty queue",
+			call: func(l *CosmicOrderList) error {
+				for range 2 {
+					if _, err := l.NextToPrepare(); err != nil {
+						return err
+					}
+				}
+				return ignore(l.NextToPrepare())
+			},
+			wantErr: ErrNothingToPrepare,
+		},
+		{name: "update at a stale revision", call: func(l *CosmicOrderList) error {
+			return ignore(l.UpdateOrder(1, models.OrderPatch{Planet: "Venus", Revision: 5}))
+		}, wantErr: ErrRevisionConflict},
+		{
+			name: "undo twice",
+			call: func(l *CosmicOrderList) error {
+				if _, err := l.Undo("manager", 2); err != nil {
+					return err
+				}
+				return ignore(l.Undo("manager", 1))
+			},
+			wantErr: ErrNothingToUndo,
+		},
+		{name: "revert unknown entry", call: func(l *CosmicOrderList) error { return l.Revert("manager", []uint64{99}) }, wantErr: ErrUndoConflict},
+		{
+			name: "revert a placement the order no longer matches",
+			call: func(l *CosmicOrderList) error {
+				if err := l.RemoveOrder(1); err != nil {
+					return err
+				}
+				return l.Revert("manager", []uint64{1})
+			},
+			wantErr: ErrUndoConflict,
+		},
+		{
+			name: "restore audit with a gap",
+			call: func(l *CosmicOrderList) error {
+				return l.RestoreAudit([]models.AuditEntry{{Seq: 1, Action: models.AuditAdded, OrderID: 1}, {Seq: 3, Action: models.AuditAdded, OrderID: 2}})
+			},
+			wantErr: ErrAuditGap,
+		},
+		{name: "illegal transition", call: func(l *CosmicOrderList) error { return l.Advance(1, models.StatusDelivered) }, wantErr: ErrIllegalTransition},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			if opts == nil {
+				opts = []Option{WithPricer(pricing.Default())}
+			}
+			list := NewService(opts...)
+			for id := 1; id <= 2; id++ {
+				if err := list.PlaceOrder(models.Order{OrderID: id, Planet: "Mars", PizzaType: "Galactic Cheese"}); err != nil {
+					t.Fatalf("PlaceOrder: %v", err)
+				}
+			}
+
+			// Callers such as the task processing add their own context on top
+			err := fmt.Errorf("task: %w", tt.call(list))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+
+			var transition *TransitionError
+			if isTransition := errors.As(err, &transition); isTransition != (tt.wantErr == ErrIllegalTransition) {
+				t.Errorf("errors.As(%v, *TransitionError) = %v", err, isTransition)
+			}
+			if transition != nil && (transition.OrderID != 1 || transition.From != models.StatusPlaced || transition.To != models.StatusDelivered) {
+				t.Errorf("TransitionError = %+v", transition)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package cosmicorder
+
+import (
+	"time"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+)
+
+const (
+	// defaultEventHistory is the number of recent events kept for resuming subscribers.
+	defaultEventHistory = 1024
+	// defaultEventBuffer is the channel capacity of a subscription.
+	defaultEventBuffer = 64
+)
+
+// WithEventHistory sets how many recent events are kept so reconnecting subscribers can resume.
+func WithEventHistory(n int) Option {
+	return func(s *CosmicOrderList) {
+		s.events.history = make([]models.OrderEvent, max(n, 0))
+	}
+}
+
+// SubscribeOption configures a subscription.
+type SubscribeOption func(*subscriber)
+
+// WithEventBuffer sets the channel capacity of the subscription.
+// Events that do not fit are dropped and counted in the Dropped field of the next delivered event.
+func WithEventBuffer(n int) SubscribeOption {
+	return func(sub *subscriber) {
+		sub.buffer = max(n, 0)
+	}
+}
+
+// ResumeAfter replays the matching events with a sequence number greater than seq
+// before delivering new ones. Events that already left the history are reported as dropped.
+func ResumeAfter(seq uint64) SubscribeOption {
+	return func(sub *subscriber) {
+		sub.resume, sub.after = true, seq
+	}
+}
+
+// subscriber is a single consumer of the event feed.
+type subscriber struct {
+	ch      chan models.OrderEvent
+	filter  Predicate
+	buffer  int
+	resume  bool
+	after   uint64
+	dropped uint64 // dropped counts events missed since the last delivered one
+}
+
+// eventFeed holds the subscribers and a ring buffer of the most recent events.
+type eventFeed struct {
+	seq         uint64
+	history     []models.OrderEvent
+	subscribers map[*subscriber]struct{}
+	dropped     uint64 // dropped counts events dropped across all subscribers
+}
+
+// Subscribe returns a channel receiving the events of orders matching filter, and a function
+// that ends the subscription and closes the channel. A zero Predicate matches every order;
+// reset events are delivered to every subscriber.
+// Events are sent without blocking: a subscriber that falls behind loses events instead of
+// slowing the list down, and learns about it through OrderEvent.Dropped.
+func (s *CosmicOrderList) Subscribe(filter Predicate, opts ...SubscribeOption) (<-chan models.OrderEvent, func()) {
+	sub := &subscriber{filter: filter, buffer: defaultEventBuffer}
+	for _, opt := range opts {
+		opt(sub)
+	}
+	sub.ch = make(chan models.OrderEvent, sub.buffer)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sub.resume {
+		s.replay(sub)
+	}
+	s.events.subscribers[sub] = struct{}{}
+
+	cancel := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if _, ok := s.events.subscribers[sub]; ok {
+			delete(s.events.subscribers, sub)
+			close(sub.ch)
+		}
+	}
+	return sub.ch, cancel
+}
+
+// LastEventSeq returns the sequence number of the latest event, 0 if there was none.
+func (s *CosmicOrderList) LastEventSeq() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.events.seq
+}
+
+// DroppedEvents returns the number of events dropped because a subscriber was too slow,
+// or resumed after they had left the history.
+func (s *CosmicOrderList) DroppedEvents() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.events.dropped
+}
+
+// emit records a change of node and delivers it to the subscribers. from is the previous status
+// of status changes. It must be called with the write lock held, right after the change.
+func (s *CosmicOrderList) emit(typ models.OrderEventType, node *models.Order, from models.OrderStatus) {
+	s.events.seq++
+	event := models.OrderEvent{Seq: s.events.seq, Type: typ, From: from, At: time.Now()}
+	if node != nil {
+		event.OrderID = node.OrderID
+		event.Order = detach(node)
+	}
+
+	if size := uint64(len(s.events.history)); size > 0 {
+		s.events.history[(event.Seq-1)%size] = event
+	}
+	for sub := range s.events.subscribers {
+		s.deliver(sub, event)
+	}
+}
+
+// replay delivers the events kept in the history that the subscriber has not seen yet.
+func (s *CosmicOrderList) replay(sub *subscriber) {
+	size := uint64(len(s.events.history))
+	oldest := uint64(1)
+	if s.events.seq > size {
+		oldest = s.events.seq - size + 1
+	}
+
+	from := sub.after + 1
+	if from < oldest {
+		sub.dropped += oldest - from
+		s.events.dropped += oldest - from
+		from = oldest
+	}
+	for seq := from; seq <= s.events.seq; seq++ {
+		s.deliver(sub, s.events.history[(seq-1)%size])
+	}
+}
+
+// deliver sends the event if it matches the subscription, dropping it if the buffer is full.
+func (s *CosmicOrderList) deliver(sub *subscriber, event models.OrderEvent) {
+	if event.Type != models.EventOrdersReset && !sub.filter.matches(&event.Order) {
+		return
+	}
+
+	event.Dropped = sub.dropped
+	select {
+	case sub.ch <- event:
+		sub.dropped = 0
+	default:
+		sub.dropped++
+		s.events.dropped++
+	}
+}
@@ -0,0 +1,132 @@
+package cosmicorder
+
+import (
+	"testing"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+)
+
+// placeOrders places the orders with the given IDs, to Mars for odd IDs and to Venus for even ones.
+func placeOrders(t *testing.T, list *CosmicOrderList, ids ...int) {
+	t.Helper()
+
+	for _, id := range ids {
+		planet := "Mars"
+		if id%2 == 0 {
+			planet = "Venus"
+		}
+		if err := list.PlaceOrder(models.Order{OrderID: id, Planet: planet, PizzaType: "Galactic Cheese"}); err != nil {
+			t.Fatalf("place order #%d: %v", id, err)
+		}
+	}
+}
+
+// received returns the events waiting in ch without blocking.
+func received(ch <-chan models.OrderEvent) []models.OrderEvent {
+	var events []models.OrderEvent
+	for {
+		select {
+		case event := <-ch:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+// seqs returns the sequence numbers of events.
+func seqs(events []models.OrderEvent) []uint64 {
+	seqs := make([]uint64, len(events))
+	for i, event := range events {
+		seqs[i] = event.Seq
+	}
+	return seqs
+}
+
+func TestSubscribeFiltersEvents(t *testing.T) {
+	list := NewService()
+	events, cancel := list.Subscribe(ByPlanet("Mars"))
+	defer cancel()
+
+	placeOrders(t, list, 1, 2, 3)
+
+	got := received(events)
+	if len(got) != 2 || got[0].OrderID != 1 || got[1].OrderID != 3 {
+		t.Fatalf("received %+v, want the events of orders #1 and #3", got)
+	}
+	if got[0].Type != models.EventOrderAdded || got[1].Seq != 3 {
+		t.Errorf("received %+v, want placements with their feed sequence numbers", got)
+	}
+}
+
+func TestSubscribeReportsDroppedEvents(t *testing.T) {
+	list := NewService()
+	events, cancel := list.Subscribe(Predicate{}, WithEventBuffer(1))
+	defer cancel()
+
+	placeOrders(t, list, 1, 2, 3)
+	if got := received(events); len(got) != 1 || got[0].OrderID != 1 || got[0].Dropped != 0 {
+		t.Fatalf("received %+v, want only the event of order #1", got)
+	}
+	if n := list.DroppedEvents(); n != 2 {
+		t.Errorf("DroppedEvents = %d, want 2", n)
+	}
+
+	placeOrders(t, list, 4)
+	got := received(events)
+	if len(got) != 1 || got[0].OrderID != 4 || got[0].Dropped != 2 {
+		t.Fatalf("received %+v, want the event of order #4 reporting 2 dropped events", got)
+	}
+
+	placeOrders(t, list, 5)
+	if got := received(events); len(got) != 1 || got[0].Dropped != 0 {
+		t.Errorf("received %+v, want the drop count reset after a delivery", got)
+	}
+}
+
+func TestSubscribeResumes(t *testing.T) {
+	tests := []struct {
+		name        string
+		history     int
+		after       uint64
+		want        []uint64
+		wantDropped uint64
+	}{
+		{name: "from the start", history: 16, after: 0, want: []uint64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}},
+		{name: "inside the history", history: 16, after: 7, want: []uint64{8, 9, 10}},
+		{name: "up to date", history: 16, after: 10},
+		{name: "after the history wrapped", history: 4, after: 2, want: []uint64{7, 8, 9, 10}, wantDropped: 4},
+		{name: "without history", history: 0, after: 2, wantDropped: 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list := NewService(WithEventHistory(tt.history))
+			placeOrders(t, list, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10)
+
+			events, cancel := list.Subscribe(Predicate{}, ResumeAfter(tt.after))
+			defer cancel()
+
+			got := received(events)
+			if len(got) != len(tt.want) {
+				t.Fatalf("replayed %v, want %v", seqs(got), tt.want)
+			}
+			for i, event := range got {
+				if event.Seq != tt.want[i] {
+					t.Fatalf("replayed %v, want %v", seqs(got), tt.want)
+				}
+			}
+			if len(got) > 0 && got[0].Dropped != tt.wantDropped {
+				t.Errorf("first replayed event reports %d dropped, want %d", got[0].Dropped, tt.wantDropped)
+			}
+			if n := list.DroppedEvents(); n != tt.wantDropped {
+				t.Errorf("DroppedEvents = %d, want %d", n, tt.wantDropped)
+			}
+
+			// The next live event follows the replay
+			placeOrders(t, list, 11)
+			if live := received(events); len(live) != 1 || live[0].Seq != 11 {
+				t.Errorf("received %v after the replay, want [11]", seqs(live))
+			}
+		})
+	}
+}
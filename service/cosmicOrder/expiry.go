@@ -0,0 +1,120 @@
+package cosmicorder
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+)
+
+// ExpiryActor is recorded in the audit trail for orders removed because they expired.
+const ExpiryActor = "reaper"
+
+// TTLPolicy decides how long a placed order may wait for the kitchen.
+// A zero TTL means orders never expire.
+type TTLPolicy struct {
+	Default time.Duration            // Default applies to planets without an override
+	Planets map[string]time.Duration // Planets overrides the default per planet
+}
+
+// TTL returns the time to live of orders delivered to planet.
+func (p TTLPolicy) TTL(planet string) time.Duration {
+	if ttl, ok := p.Planets[planet]; ok {
+		return ttl
+	}
+	return p.Default
+}
+
+// expiresAt returns when an order to planet placed at placed expires, zero if it never does.
+func (p TTLPolicy) expiresAt(planet string, placed time.Time) time.Time {
+	ttl := p.TTL(planet)
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return placed.Add(ttl)
+}
+
+// ExpiryAction is what Expire does with an expired order.
+type ExpiryAction int
+
+const (
+	// ExpireCancel moves expired orders to Cancelled and keeps them in the list.
+	ExpireCancel ExpiryAction = iota
+	// ExpireRemove removes expired orders from the list.
+	ExpireRemove
+)
+
+// WithTTL sets when placed orders expire. An order placed with a non-zero ExpiresAt keeps it.
+func WithTTL(policy TTLPolicy) Option {
+	return func(s *CosmicOrderList) {
+		s.ttl = policy
+	}
+}
+
+// WithExpiryAction sets what Expire does with expired orders. The default is ExpireCancel.
+func WithExpiryAction(action ExpiryAction) Option {
+	return func(s *CosmicOrderList) {
+		s.expiry = action
+	}
+}
+
+// Expire cancels or removes every placed order whose ExpiresAt is not after now and
+// emits an EventOrderExpired for each. Orders that already left the kitchen queue never expire.
+// It returns the expired orders, earliest expiry first: cancelled orders in their new status,
+// removed orders as they were before the removal. The in-memory list never fails to expire;
+// the error lets stores that write the change elsewhere report it.
+func (s *CosmicOrderList) Expire(now time.Time) ([]models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []*models.Order
+	for _, entry := range s.queue.entries {
+		if expiresAt := entry.node.ExpiresAt; !expiresAt.IsZero() && !expiresAt.After(now) {
+			due = append(due, entry.node)
+		}
+	}
+	slices.SortFunc(due, func(a, b *models.Order) int {
+		return cmp.Or(a.ExpiresAt.Compare(b.ExpiresAt), cmp.Compare(a.OrderID, b.OrderID))
+	})
+	return s.expire(now, due), nil
+}
+
+// ExpireOrders expires every version of the listed orders still waiting in the kitchen queue,
+// in the given order, whether they are due or not. It repeats an earlier Expire, e.g. when
+// a journaled expiry run is replayed, and returns the expired orders like Expire.
+func (s *CosmicOrderList) ExpireOrders(now time.Time, orderIDs []int) ([]models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []*models.Order
+	for _, orderID := range orderIDs {
+		nodes := s.versions[orderID]
+		if node, ok := s.index[orderID]; ok {
+			nodes = append(slices.Clip(nodes), node)
+		}
+		for _, node := range nodes {
+			if _, queued := s.queue.byOrder[node]; queued && !slices.Contains(due, node) {
+				due = append(due, node)
+			}
+		}
+	}
+	return s.expire(now, due), nil
+}
+
+// expire cancels or removes the due orders. s.mu must be held.
+func (s *CosmicOrderList) expire(now time.Time, due []*models.Order) []models.Order {
+	expired := make([]models.Order, 0, len(due))
+	for _, node := range due {
+		if s.expiry == ExpireRemove {
+			expired = append(expired, detach(node))
+			s.removeNode(ExpiryActor, node, models.EventOrderExpired)
+			continue
+		}
+		setStatus(node, models.StatusCancelled, now)
+		s.queue.dequeue(node)
+		s.emit(models.EventOrderExpired, node, models.StatusPlaced)
+		expired = append(expired, detach(node))
+	}
+	return expired
+}
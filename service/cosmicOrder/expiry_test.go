@@ -0,0 +1,97 @@
+package cosmicorder
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+)
+
+func TestExpire(t *testing.T) {
+	policy := TTLPolicy{
+		Default: time.Minute,
+		Planets: map[string]time.Duration{"Pluto": time.Hour, "Venus": 0},
+	}
+	tests := []struct {
+		name    string
+		action  ExpiryAction
+		after   time.Duration // after is how long after the placement Expire runs
+		expired []int
+		left    []int // left is the orders still stored after the run
+	}{
+		{name: "nothing due", after: 30 * time.Second, left: []int{1, 2, 3, 4, 5}},
+		{name: "default TTL cancels", after: 2 * time.Minute, expired: []int{1}, left: []int{1, 2, 3, 4, 5}},
+		{name: "planet override cancels", after: 2 * time.Hour, expired: []int{1, 2}, left: []int{1, 2, 3, 4, 5}},
+		{name: "default TTL removes", action: ExpireRemove, after: 2 * time.Minute, expired: []int{1}, left: []int{2, 3, 4, 5}},
+		{name: "planet override removes", action: ExpireRemove, after: 2 * time.Hour, expired: []int{1, 2}, left: []int{3, 4, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list := NewService(WithTTL(policy), WithExpiryAction(tt.action))
+			placed := time.Now()
+
+			// #1 waits on Mars, #2 on Pluto, #3 on Venus, which has no TTL, #4 is in the kitchen and #5 is delivered
+			for id, planet := range []string{"Mars", "Pluto", "Venus", "Mars", "Mars"} {
+				if err := list.PlaceOrder(models.Order{OrderID: id + 1, Planet: planet, PizzaType: "Galactic Cheese"}); err != nil {
+					t.Fatalf("PlaceOrder: %v", err)
+				}
+			}
+			for _, status := range []models.OrderStatus{models.StatusPreparing, models.StatusBaking, models.StatusOutForDelivery, models.StatusDelivered} {
+				if err := list.Advance(5, status); err != nil {
+					t.Fatalf("Advance(%s): %v", status, err)
+				}
+			}
+			if err := list.Advance(4, models.StatusPreparing); err != nil {
+				t.Fatalf("Advance: %v", err)
+			}
+
+			now := placed.Add(tt.after)
+			expired, err := list.Expire(now)
+			if err != nil {
+				t.Fatalf("Expire: %v", err)
+			}
+			var ids []int
+			for _, order := range expired {
+				ids = append(ids, order.OrderID)
+				if tt.action == ExpireCancel && order.Status != models.StatusCancelled {
+					t.Errorf("expired order #%d is %s, want %s", order.OrderID, order.Status, models.StatusCancelled)
+				}
+				if order.ExpiresAt.After(now) {
+					t.Errorf("order #%d expired before its ExpiresAt %s", order.OrderID, order.ExpiresAt)
+				}
+			}
+			if !slices.Equal(ids, tt.expired) {
+				t.Errorf("expired %v, want %v", ids, tt.expired)
+			}
+
+			var left []int
+			for _, order := range list.Snapshot() {
+				left = append(left, order.OrderID)
+			}
+			if !slices.Equal(left, tt.left) {
+				t.Errorf("orders left %v, want %v", left, tt.left)
+			}
+			if order, _ := list.Get(4); order.Status != models.StatusPreparing {
+				t.Errorf("order in the kitchen is %s", order.Status)
+			}
+			if order, _ := list.Get(5); order.Status != models.StatusDelivered {
+				t.Errorf("delivered order is %s", order.Status)
+			}
+
+			// A second run finds nothing left to expire
+			if again, _ := list.Expire(now); len(again) != 0 {
+				t.Errorf("second run expired %d orders", len(again))
+			}
+		})
+	}
+}
+
+func TestTTL(t *testing.T) {
+	policy := TTLPolicy{Default: time.Minute, Planets: map[string]time.Duration{"Pluto": time.Hour, "Venus": 0}}
+	for planet, want := range map[string]time.Duration{"Mars": time.Minute, "Pluto": time.Hour, "Venus": 0} {
+		if got := policy.TTL(planet); got != want {
+			t.Errorf("TTL(%s) = %s, want %s", planet, got, want)
+		}
+	}
+}
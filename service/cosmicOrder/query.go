@@ -0,0 +1,270 @@
+package cosmicorder
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+)
+
+// Predicate selects orders in a query. Predicates built by ByPlanet and ByPizzaType
+// carry an index hint, so queries using them read the secondary indexes instead of
+// walking the whole list.
+type Predicate struct {
+	match        func(order *models.Order) bool
+	planet       string // planet is the planet index hint, set if hasPlanet.
+	pizzaType    string // pizzaType is the pizza type index hint, set if hasPizzaType.
+	hasPlanet    bool
+	hasPizzaType bool
+	exact        bool // exact is set when the index hint alone answers the predicate.
+}
+
+// ByPlanet selects orders delivered to planet.
+func ByPlanet(planet string) Predicate {
+	return Predicate{
+		match:     func(order *models.Order) bool { return order.Planet == planet },
+		planet:    planet,
+		hasPlanet: true,
+		exact:     true,
+	}
+}
+
+// ByPizzaType selects orders with at least one line item of the given pizza type.
+func ByPizzaType(pizzaType string) Predicate {
+	return Predicate{
+		match:        func(order *models.Order) bool { return slices.ContainsFunc(order.Items, isPizzaType(pizzaType)) },
+		pizzaType:    pizzaType,
+		hasPizzaType: true,
+		exact:        true,
+	}
+}
+
+// ByStatus selects orders currently in status.
+func ByStatus(status models.OrderStatus) Predicate {
+	return Where(func(order models.Order) bool { return order.Status == status })
+}
+
+// PlacedSince selects orders placed at or after t.
+func PlacedSince(t time.Time) Predicate {
+	return Predicate{match: func(order *models.Order) bool {
+		return len(order.History) > 0 && !order.History[0].At.Before(t)
+	}}
+}
+
+// Where selects orders for which fn returns true.
+func Where(fn func(order models.Order) bool) Predicate {
+	return Predicate{match: func(order *models.Order) bool { return fn(*order) }}
+}
+
+// And selects orders matching every predicate. Index hints are kept.
+func And(preds ...Predicate) Predicate {
+	p := Predicate{match: func(order *models.Order) bool { return matchAll(preds, order) }}
+	for _, pred := range preds {
+		if !p.hasPlanet && pred.hasPlanet {
+			p.planet, p.hasPlanet = pred.planet, true
+		}
+		if !p.hasPizzaType && pred.hasPizzaType {
+			p.pizzaType, p.hasPizzaType = pred.pizzaType, true
+		}
+	}
+	return p
+}
+
+// Or selects orders matching at least one predicate.
+func Or(preds ...Predicate) Predicate {
+	return Predicate{match: func(order *models.Order) bool {
+		for _, pred := range preds {
+			if pred.matches(order) {
+				return true
+			}
+		}
+		return false
+	}}
+}
+
+// Not selects orders that do not match pred.
+func Not(pred Predicate) Predicate {
+	return Predicate{match: func(order *models.Order) bool { return !pred.matches(order) }}
+}
+
+// matches reports whether the order is selected. A zero Predicate matches every order.
+func (p Predicate) matches(order *models.Order) bool {
+	return p.match == nil || p.match(order)
+}
+
+// Query returns the orders matching all predicates, sorted by OrderID and Version.
+func (s *CosmicOrderList) Query(preds ...Predicate) []models.Order {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	orders := []models.Order{}
+	s.scan(preds, func(node *models.Order) {
+		orders = append(orders, detach(node))
+	})
+	slices.SortFunc(orders, func(a, b models.Order) int {
+		return cmp.Or(cmp.Compare(a.OrderID, b.OrderID), cmp.Compare(a.Version, b.Version))
+	})
+	return orders
+}
+
+// Count returns the number of orders matching all predicates.
+// A single ByPlanet or ByPizzaType predicate is answered from the index in O(1).
+func (s *CosmicOrderList) Count(preds ...Predicate) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(preds) == 1 && preds[0].exact {
+		if preds[0].hasPlanet {
+			return len(s.byPlanet[preds[0].planet])
+		}
+		return len(s.byPizzaType[preds[0].pizzaType])
+	}
+
+	count := 0
+	s.scan(preds, func(*models.Order) { count++ })
+	return count
+}
+
+// CountByPlanet returns the number of orders per planet.
+func (s *CosmicOrderList) CountByPlanet() map[string]int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return indexSizes(s.byPlanet)
+}
+
+// CountByPizzaType returns the number of orders containing each pizza type.
+func (s *CosmicOrderList) CountByPizzaType() map[string]int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return indexSizes(s.byPizzaType)
+}
+
+// CountByStatus returns the number of orders per status.
+func (s *CosmicOrderList) CountByStatus(preds ...Predicate) map[models.OrderStatus]int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[models.OrderStatus]int)
+	s.scan(preds, func(node *models.Order) { counts[node.Status]++ })
+	return counts
+}
+
+// GroupCount returns the number of orders matching all predicates per key.
+func (s *CosmicOrderList) GroupCount(key func(order models.Order) string, preds ...Predicate) map[string]int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[string]int)
+	s.scan(preds, func(node *models.Order) { counts[key(*node)]++ })
+	return counts
+}
+
+// scan calls fn for every order matching all predicates.
+// It reads the smallest index bucket the predicates hint at, or walks the list otherwise.
+func (s *CosmicOrderList) scan(preds []Predicate, fn func(node *models.Order)) {
+	candidates, indexed := s.candidates(preds)
+	if !indexed {
+		for node := s.head; node != nil; node = node.Next {
+			if matchAll(preds, node) {
+				fn(node)
+			}
+		}
+		return
+	}
+
+	for node := range candidates {
+		if matchAll(preds, node) {
+			fn(node)
+		}
+	}
+}
+
+// candidates returns the smallest index bucket hinted at by preds.
+func (s *CosmicOrderList) candidates(preds []Predicate) (orderSet, bool) {
+	var (
+		best    orderSet
+		indexed bool
+	)
+	consider := func(bucket orderSet) {
+		if !indexed || len(bucket) < len(best) {
+			best, indexed = bucket, true
+		}
+	}
+	for _, pred := range preds {
+		if pred.hasPlanet {
+			consider(s.byPlanet[pred.planet])
+		}
+		if pred.hasPizzaType {
+			consider(s.byPizzaType[pred.pizzaType])
+		}
+	}
+	return best, indexed
+}
+
+// indexNode adds the node to the secondary indexes.
+func (s *CosmicOrderList) indexNode(node *models.Order) {
+	addToIndex(s.byPlanet, node.Planet, node)
+	for _, pizzaType := range pizzaTypes(node) {
+		addToIndex(s.byPizzaType, pizzaType, node)
+	}
+}
+
+// unindexNode removes the node from the secondary indexes.
+func (s *CosmicOrderList) unindexNode(node *models.Order) {
+	removeFromIndex(s.byPlanet, node.Planet, node)
+	for _, pizzaType := range pizzaTypes(node) {
+		removeFromIndex(s.byPizzaType, pizzaType, node)
+	}
+}
+
+// pizzaTypes returns the distinct pizza types of the order items.
+func pizzaTypes(order *models.Order) []string {
+	types := make([]string, 0, len(order.Items))
+	for _, item := range order.Items {
+		if !slices.Contains(types, item.PizzaType) {
+			types = append(types, item.PizzaType)
+		}
+	}
+	return types
+}
+
+func isPizzaType(pizzaType string) func(models.LineItem) bool {
+	return func(item models.LineItem) bool { return item.PizzaType == pizzaType }
+}
+
+func addToIndex(index map[string]orderSet, key string, node *models.Order) {
+	bucket, ok := index[key]
+	if !ok {
+		bucket = make(orderSet)
+		index[key] = bucket
+	}
+	bucket[node] = struct{}{}
+}
+
+func removeFromIndex(index map[string]orderSet, key string, node *models.Order) {
+	bucket := index[key]
+	delete(bucket, node)
+	if len(bucket) == 0 {
+		delete(index, key)
+	}
+}
+
+func indexSizes(index map[string]orderSet) map[string]int {
+	sizes := make(map[string]int, len(index))
+	for key, bucket := range index {
+		sizes[key] = len(bucket)
+	}
+	return sizes
+}
+
+func matchAll(preds []Predicate, order *models.Order) bool {
+	for _, pred := range preds {
+		if !pred.matches(order) {
+			return false
+		}
+	}
+	return true
+}
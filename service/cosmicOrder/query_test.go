@@ -0,0 +1,53 @@
+package cosmicorder
+
+import (
+	"testing"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+)
+
+func TestCountMatchesQuery(t *testing.T) {
+	list := NewService()
+	err := list.Restore([]models.Order{
+		{OrderID: 1, PizzaType: "Galactic Cheese", Items: items("Galactic Cheese")}, // restored without a planet
+		{OrderID: 2, Planet: "Mars", PizzaType: "Galactic Cheese", Items: items("Galactic Cheese")},
+		{OrderID: 3, Planet: "Venus", PizzaType: "Antimatter Pizza", Items: items("Antimatter Pizza")},
+	})
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		preds []Predicate
+		want  int
+	}{
+		{name: "planet", preds: []Predicate{ByPlanet("Mars")}, want: 1},
+		{name: "empty planet", preds: []Predicate{ByPlanet("")}, want: 1},
+		{name: "unknown planet", preds: []Predicate{ByPlanet("Pluto")}, want: 0},
+		{name: "pizza type", preds: []Predicate{ByPizzaType("Galactic Cheese")}, want: 2},
+		{name: "empty pizza type", preds: []Predicate{ByPizzaType("")}, want: 0},
+		{name: "empty planet and pizza type", preds: []Predicate{And(ByPlanet(""), ByPizzaType("Galactic Cheese"))}, want: 1},
+		{name: "pizza type and empty planet", preds: []Predicate{ByPizzaType("Galactic Cheese"), ByPlanet("")}, want: 1},
+		{name: "no predicate", want: 3},
+		{name: "zero predicate", preds: []Predicate{{}}, want: 3},
+		{name: "or with a zero predicate", preds: []Predicate{Or(ByPlanet("Pluto"), Predicate{})}, want: 3},
+		{name: "not a zero predicate", preds: []Predicate{Not(Predicate{})}, want: 0},
+		{name: "not or", preds: []Predicate{Not(Or(ByPlanet("Mars"), ByPlanet("Venus")))}, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := list.Count(tt.preds...); got != tt.want {
+				t.Errorf("Count = %d, want %d", got, tt.want)
+			}
+			if got := len(list.Query(tt.preds...)); got != tt.want {
+				t.Errorf("Query returned %d orders, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// items returns one medium pizza of pizzaType.
+func items(pizzaType string) []models.LineItem {
+	return []models.LineItem{{PizzaType: pizzaType, Size: models.SizeMedium, Quantity: 1}}
+}
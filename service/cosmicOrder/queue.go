@@ -0,0 +1,158 @@
+package cosmicorder
+
+import (
+	"container/heap"
+	"time"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+)
+
+// queued is a placed order waiting in the kitchen queue.
+type queued struct {
+	node    *models.Order
+	arrival uint64 // arrival orders orders that are otherwise equal
+	pos     int    // pos is the position of the entry in the heap
+}
+
+// prepQueue is a heap of the placed orders, the next one to prepare on top.
+// It implements heap.Interface.
+type prepQueue struct {
+	entries  []*queued
+	byOrder  map[*models.Order]*queued
+	arrivals uint64
+}
+
+func newPrepQueue() prepQueue {
+	return prepQueue{byOrder: make(map[*models.Order]*queued)}
+}
+
+func (q *prepQueue) Len() int { return len(q.entries) }
+
+// Less puts the order to prepare first on top, earlier arrivals first among equal orders.
+func (q *prepQueue) Less(i, j int) bool {
+	a, b := q.entries[i], q.entries[j]
+	if PreparesBefore(*a.node, *b.node) {
+		return true
+	}
+	if PreparesBefore(*b.node, *a.node) {
+		return false
+	}
+	return a.arrival < b.arrival
+}
+
+func (q *prepQueue) Swap(i, j int) {
+	q.entries[i], q.entries[j] = q.entries[j], q.entries[i]
+	q.entries[i].pos = i
+	q.entries[j].pos = j
+}
+
+func (q *prepQueue) Push(x any) {
+	entry := x.(*queued)
+	entry.pos = len(q.entries)
+	q.entries = append(q.entries, entry)
+}
+
+func (q *prepQueue) Pop() any {
+	last := len(q.entries) - 1
+	entry := q.entries[last]
+	q.entries[last] = nil
+	q.entries = q.entries[:last]
+	return entry
+}
+
+// enqueue adds a placed order to the queue.
+func (q *prepQueue) enqueue(node *models.Order) {
+	if _, ok := q.byOrder[node]; ok {
+		return
+	}
+	q.arrivals++
+	entry := &queued{node: node, arrival: q.arrivals}
+	q.byOrder[node] = entry
+	heap.Push(q, entry)
+}
+
+// dequeue removes an order from the queue if it is waiting in it.
+func (q *prepQueue) dequeue(node *models.Order) {
+	entry, ok := q.byOrder[node]
+	if !ok {
+		return
+	}
+	heap.Remove(q, entry.pos)
+	delete(q.byOrder, node)
+}
+
+// requeue restores the heap order after the priority, VIP flag or deadline of a queued order changed.
+func (q *prepQueue) requeue(node *models.Order) {
+	if entry, ok := q.byOrder[node]; ok {
+		heap.Fix(q, entry.pos)
+	}
+}
+
+// reorder renumbers the arrivals of the queued orders in list order, starting at head.
+func (q *prepQueue) reorder(head *models.Order) {
+	q.arrivals = 0
+	for node := head; node != nil; node = node.Next {
+		if entry, ok := q.byOrder[node]; ok {
+			q.arrivals++
+			entry.arrival = q.arrivals
+		}
+	}
+	heap.Init(q)
+}
+
+// PreparesBefore reports whether order a should be prepared before order b:
+// VIP orders first, then higher priorities, then earlier deadlines.
+// Orders without a deadline come after the ones with a deadline.
+func PreparesBefore(a, b models.Order) bool {
+	if a.VIP != b.VIP {
+		return a.VIP
+	}
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	if !a.Deadline.Equal(b.Deadline) {
+		if a.Deadline.IsZero() || b.Deadline.IsZero() {
+			return b.Deadline.IsZero()
+		}
+		return a.Deadline.Before(b.Deadline)
+	}
+	return false
+}
+
+// PeekNext returns the order NextToPrepare would hand out, without taking it out of the queue.
+func (s *CosmicOrderList) PeekNext() (models.Order, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.queue.Len() == 0 {
+		return models.Order{}, false
+	}
+	return detach(s.queue.entries[0].node), true
+}
+
+// NextToPrepare takes the most urgent placed order out of the kitchen queue and moves it to Preparing.
+// Orders are served VIP first, then by priority, then by deadline, then by arrival.
+// MoveOrder and Swap renumber the arrivals in list order.
+// It returns ErrNothingToPrepare if no order is waiting.
+func (s *CosmicOrderList) NextToPrepare() (models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.queue.Len() == 0 {
+		return models.Order{}, ErrNothingToPrepare
+	}
+	node := s.queue.entries[0].node
+	s.queue.dequeue(node)
+
+	setStatus(node, models.StatusPreparing, time.Now())
+	s.emit(models.EventStatusChanged, node, models.StatusPlaced)
+	return detach(node), nil
+}
+
+// Waiting returns the number of placed orders in the kitchen queue.
+func (s *CosmicOrderList) Waiting() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.queue.Len()
+}
@@ -0,0 +1,117 @@
+package cosmicorder
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+)
+
+// drainKitchen takes every order out of the kitchen queue and returns their IDs.
+func drainKitchen(t *testing.T, list *CosmicOrderList) []int {
+	t.Helper()
+
+	var prepared []int
+	for {
+		order, err := list.NextToPrepare()
+		if errors.Is(err, ErrNothingToPrepare) {
+			return prepared
+		}
+		if err != nil {
+			t.Fatalf("NextToPrepare: %v", err)
+		}
+		if order.Status != models.StatusPreparing {
+			t.Errorf("order #%d handed out as %s, want %s", order.OrderID, order.Status, models.StatusPreparing)
+		}
+		prepared = append(prepared, order.OrderID)
+	}
+}
+
+func TestNextToPrepareOrder(t *testing.T) {
+	now := time.Now()
+	order := func(id int, vip bool, priority int, deadline time.Duration) models.Order {
+		o := models.Order{OrderID: id, Planet: "Mars", PizzaType: "Galactic Cheese", VIP: vip, Priority: priority}
+		if deadline > 0 {
+			o.Deadline = now.Add(deadline)
+		}
+		return o
+	}
+	tests := []struct {
+		name   string
+		orders []models.Order
+		want   []int
+	}{
+		{name: "arrival among equals", orders: []models.Order{order(1, false, 0, 0), order(2, false, 0, 0), order(3, false, 0, 0)}, want: []int{1, 2, 3}},
+		{name: "VIP first", orders: []models.Order{order(1, false, 0, 0), order(2, true, 0, 0)}, want: []int{2, 1}},
+		{name: "VIP before priority", orders: []models.Order{order(1, false, 9, time.Minute), order(2, true, 0, 0)}, want: []int{2, 1}},
+		{name: "higher priority first", orders: []models.Order{order(1, false, 0, 0), order(2, false, 2, 0), order(3, false, 1, 0)}, want: []int{2, 3, 1}},
+		{name: "priority before deadline", orders: []models.Order{order(1, false, 0, time.Minute), order(2, false, 1, time.Hour)}, want: []int{2, 1}},
+		{name: "earlier deadline first", orders: []models.Order{order(1, false, 0, time.Hour), order(2, false, 0, time.Minute)}, want: []int{2, 1}},
+		{name: "deadline before none", orders: []models.Order{order(1, false, 0, 0), order(2, false, 0, time.Hour)}, want: []int{2, 1}},
+		{name: "equal deadlines by arrival", orders: []models.Order{order(1, false, 0, time.Hour), order(2, false, 0, time.Hour)}, want: []int{1, 2}},
+		{
+			name: "mixed",
+			orders: []models.Order{
+				order(1, false, 0, 0), order(2, false, 1, 30*time.Minute), order(3, false, 1, 10*time.Minute),
+				order(4, true, 0, 0), order(5, false, 0, time.Hour), order(6, false, 0, 0),
+			},
+			want: []int{4, 3, 2, 5, 1, 6},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list := NewService()
+			for _, o := range tt.orders {
+				if err := list.PlaceOrder(o); err != nil {
+					t.Fatalf("place order #%d: %v", o.OrderID, err)
+				}
+			}
+			if list.Waiting() != len(tt.orders) {
+				t.Errorf("Waiting = %d, want %d", list.Waiting(), len(tt.orders))
+			}
+			if got := drainKitchen(t, list); !slices.Equal(got, tt.want) {
+				t.Errorf("kitchen order %v, want %v", got, tt.want)
+			}
+			for i := 1; i < len(tt.want); i++ {
+				a, _ := list.Get(tt.want[i-1])
+				b, _ := list.Get(tt.want[i])
+				if PreparesBefore(b, a) {
+					t.Errorf("PreparesBefore(#%d, #%d) contradicts the kitchen order", b.OrderID, a.OrderID)
+				}
+			}
+		})
+	}
+}
+
+func TestQueueFollowsUpdates(t *testing.T) {
+	list := NewService(WithDuplicatePolicy(DuplicateUpsert))
+	for id := 1; id <= 4; id++ {
+		if err := list.PlaceOrder(models.Order{OrderID: id, Planet: "Mars", PizzaType: "Galactic Cheese"}); err != nil {
+			t.Fatalf("place order #%d: %v", id, err)
+		}
+	}
+
+	// Upserting order #3 as VIP moves it to the front, order #2 leaves the queue when it is cancelled
+	if err := list.PlaceOrder(models.Order{OrderID: 3, Planet: "Mars", PizzaType: "Galactic Cheese", VIP: true}); err != nil {
+		t.Fatalf("upsert order #3: %v", err)
+	}
+	if err := list.Advance(2, models.StatusCancelled); err != nil {
+		t.Fatalf("cancel order #2: %v", err)
+	}
+	if next, ok := list.PeekNext(); !ok || next.OrderID != 3 {
+		t.Fatalf("PeekNext = #%d, %v; want #3", next.OrderID, ok)
+	}
+
+	// Dropping the VIP flag again puts order #3 back in arrival order
+	if err := list.PlaceOrder(models.Order{OrderID: 3, Planet: "Mars", PizzaType: "Galactic Cheese"}); err != nil {
+		t.Fatalf("upsert order #3: %v", err)
+	}
+	if got, want := drainKitchen(t, list), []int{1, 3, 4}; !slices.Equal(got, want) {
+		t.Errorf("kitchen order %v, want %v", got, want)
+	}
+	if _, ok := list.PeekNext(); ok {
+		t.Error("PeekNext found an order in an empty queue")
+	}
+}
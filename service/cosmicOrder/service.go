@@ -1,87 +1,401 @@
 package cosmicorder
 
 import (
+	"fmt"
+	"iter"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/gleb-korostelev/CosmicPizza.git/models"
-	"github.com/gleb-korostelev/CosmicPizza.git/tools/logger"
+	"github.com/gleb-korostelev/CosmicPizza.git/service/menu"
+	"github.com/gleb-korostelev/CosmicPizza.git/service/pricing"
+	"github.com/gleb-korostelev/CosmicPizza.git/service/storage"
 )
 
-// CosmicOrderList represents a linked list of orders
+var (
+	_ storage.AuditedOrderStore    = (*CosmicOrderList)(nil)
+	_ storage.ExpiringOrderStore   = (*CosmicOrderList)(nil)
+	_ storage.RevertibleOrderStore = (*CosmicOrderList)(nil)
+)
+
+// CosmicOrderList represents a doubly linked list of orders.
+// The tail pointer and the OrderID index make append, lookup and removal O(1).
 type CosmicOrderList struct {
-	head *models.Order
-	mu   sync.Mutex
+	head   *models.Order
+	tail   *models.Order
+	index  map[int]*models.Order // index maps every OrderID to the node of its current version
+	length int
+
+	versions   map[int][]*models.Order // versions holds the older versions kept by DuplicateKeepBoth, oldest first
+	duplicates DuplicatePolicy         // duplicates decides what to do with an already stored OrderID
+	ids        *IDAllocator            // ids is told about every stored OrderID, nil if unused
+
+	ttl    TTLPolicy    // ttl decides when placed orders expire
+	expiry ExpiryAction // expiry decides what Expire does with expired orders
+
+	byPlanet    map[string]orderSet // byPlanet indexes orders by Planet
+	byPizzaType map[string]orderSet // byPizzaType indexes orders by the pizza types of their items
+
+	menu   *menu.Menu // menu validates line items, nil disables validation
+	pricer Pricer     // pricer prices orders at checkout
+
+	events eventFeed  // events is the change feed of the list
+	audit  auditTrail // audit records who added, inserted and removed orders
+	queue  prepQueue  // queue holds the placed orders in the order they should be prepared
+
+	mu sync.RWMutex
+}
+
+// orderSet is a set of order nodes.
+type orderSet map[*models.Order]struct{}
+
+// Option configures a CosmicOrderList.
+type Option func(*CosmicOrderList)
+
+// WithMenu sets the menu orders are validated against. A nil menu disables validation.
+func WithMenu(m *menu.Menu) Option {
+	return func(s *CosmicOrderList) {
+		s.menu = m
+	}
 }
 
 // NewSerice creates a new instance of the CosmicOrder service
-func NewService() *CosmicOrderList {
-	return &CosmicOrderList{}
+func NewService(opts ...Option) *CosmicOrderList {
+	s := &CosmicOrderList{
+		index:       make(map[int]*models.Order),
+		versions:    make(map[int][]*models.Order),
+		byPlanet:    make(map[string]orderSet),
+		byPizzaType: make(map[string]orderSet),
+		menu:        menu.Default(),
+		pricer:      pricing.Default(),
+		events: eventFeed{
+			history:     make([]models.OrderEvent, defaultEventHistory),
+			subscribers: make(map[*subscriber]struct{}),
+		},
+		audit: newAuditTrail(defaultAuditLimit),
+		queue: newPrepQueue(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
-// AddOrder adds an order to the end of the list
-func (s *CosmicOrderList) AddOrder(orderID int, planet, pizzaType string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// AddOrder adds a single-pizza order to the end of the list.
+// It returns ErrDuplicateOrder if an order with the same ID is already stored.
+func (s *CosmicOrderList) AddOrder(orderID int, planet, pizzaType string) error {
+	return s.PlaceOrder(models.Order{OrderID: orderID, Planet: planet, PizzaType: pizzaType})
+}
+
+// PlaceOrder adds a multi-item order to the end of the list.
+// An order without items gets a single medium pizza of its PizzaType.
+// Items are validated against the menu, and ErrDuplicateOrder is returned if
+// an order with the same ID is already stored.
+func (s *CosmicOrderList) PlaceOrder(order models.Order) error {
+	return s.PlaceOrderAs(SystemActor, order)
+}
 
-	newOrder := &models.Order{OrderID: orderID, Planet: planet, PizzaType: pizzaType}
-	if s.head == nil {
-		s.head = newOrder
-		return
+// InsertOrder inserts an order at a specific index.
+// It returns ErrIndexOutOfRange if index is negative or bigger than the list,
+// and ErrDuplicateOrder if an order with the same ID is already stored.
+func (s *CosmicOrderList) InsertOrder(index, orderID int, planet, pizzaType string) error {
+	return s.InsertOrderAs(SystemActor, index, orderID, planet, pizzaType)
+}
+
+// place validates the order, links it at position index, emits an event of type typ
+// and records the change made by actor.
+func (s *CosmicOrderList) place(actor, op string, typ models.OrderEventType, index int, order models.Order) error {
+	if index < 0 || index > s.length {
+		return fmt.Errorf("%s order #%d at %d (length %d): %w", op, order.OrderID, index, s.length, ErrIndexOutOfRange)
+	}
+	version := 1
+	if existing, ok := s.index[order.OrderID]; ok {
+		switch s.duplicates {
+		case DuplicateUpsert:
+			if err := s.upsert(actor, existing, order); err != nil {
+				return fmt.Errorf("%s order #%d: %w", op, order.OrderID, err)
+			}
+			return nil
+		case DuplicateKeepBoth:
+			version = existing.Version + 1
+		default:
+			return fmt.Errorf("%s order #%d: %w", op, order.OrderID, ErrDuplicateOrder)
+		}
+	}
+
+	node, err := s.newOrder(order)
+	if err != nil {
+		return fmt.Errorf("%s order #%d: %w", op, order.OrderID, err)
 	}
+	node.Version = version
 
-	current := s.head
-	for current.Next != nil {
-		current = current.Next
+	var prev *models.Order
+	if index > 0 {
+		prev = s.nodeAt(index - 1)
 	}
-	current.Next = newOrder
+	s.linkAfter(prev, node)
+	s.emit(typ, node, node.Status)
+
+	action := models.AuditAdded
+	if typ == models.EventOrderInserted {
+		action = models.AuditInserted
+	}
+	after := detach(node)
+	s.record(models.AuditEntry{Action: action, OrderID: node.OrderID, Actor: actor, After: &after})
+	return nil
 }
 
-// InsertOrder inserts an order at a specific index
-func (s *CosmicOrderList) InsertOrder(index, orderID int, planet, pizzaType string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// RemoveOrder removes an order by its orderID.
+// It returns ErrOrderNotFound if no order has the ID.
+func (s *CosmicOrderList) RemoveOrder(orderID int) error {
+	return s.RemoveOrderAs(SystemActor, orderID)
+}
 
-	newOrder := &models.Order{OrderID: orderID, Planet: planet, PizzaType: pizzaType}
-	if index == 0 {
-		newOrder.Next = s.head
-		s.head = newOrder
-		return
+// remove unlinks the order, emits an event and records the change made by actor.
+func (s *CosmicOrderList) remove(actor string, orderID int) error {
+	node, ok := s.index[orderID]
+	if !ok {
+		return fmt.Errorf("remove order #%d: %w", orderID, ErrOrderNotFound)
 	}
+	s.removeNode(actor, node, models.EventOrderRemoved)
+	return nil
+}
 
-	current := s.head
-	for i := 0; i < index-1 && current != nil; i++ {
-		current = current.Next
+// removeNode unlinks node, emits an event of type typ and records the removal made by actor.
+func (s *CosmicOrderList) removeNode(actor string, node *models.Order, typ models.OrderEventType) {
+	entry := models.AuditEntry{Action: models.AuditRemoved, OrderID: node.OrderID, Actor: actor}
+	if node.Prev != nil {
+		entry.PrevOrderID, entry.HasPrev = node.Prev.OrderID, true
 	}
+	before := detach(node)
+	entry.Before = &before
+
+	s.unlink(node)
+	s.emit(typ, node, node.Status)
+	s.record(entry)
+}
 
-	if current == nil {
-		logger.Infof("Cannot insert the order - index is bigger than the list")
-		return
+// Get returns the order with the given ID.
+func (s *CosmicOrderList) Get(orderID int) (models.Order, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	node, ok := s.index[orderID]
+	if !ok {
+		return models.Order{}, false
 	}
+	return detach(node), true
+}
 
-	newOrder.Next = current.Next
-	current.Next = newOrder
+// Len returns the number of orders in the list.
+func (s *CosmicOrderList) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.length
 }
 
-// RemoveOrder removes an order by its orderID
-func (s *CosmicOrderList) RemoveOrder(orderID int) {
+// Snapshot returns a copy of all orders in list order.
+func (s *CosmicOrderList) Snapshot() []models.Order {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.collect(s.head, s.length)
+}
+
+// Page returns up to limit orders starting at position offset.
+func (s *CosmicOrderList) Page(offset, limit int) []models.Order {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if offset < 0 || limit <= 0 || offset >= s.length {
+		return []models.Order{}
+	}
+	return s.collect(s.nodeAt(offset), limit)
+}
+
+// All returns an iterator over the orders in list order.
+// The iterator walks a snapshot taken when iteration starts, so writers are never blocked by a slow consumer.
+func (s *CosmicOrderList) All() iter.Seq[models.Order] {
+	return func(yield func(models.Order) bool) {
+		for _, order := range s.Snapshot() {
+			if !yield(order) {
+				return
+			}
+		}
+	}
+}
+
+// collect copies up to limit orders starting at node.
+func (s *CosmicOrderList) collect(node *models.Order, limit int) []models.Order {
+	orders := make([]models.Order, 0, min(limit, s.length))
+	for current := node; current != nil && len(orders) < limit; current = current.Next {
+		orders = append(orders, detach(current))
+	}
+	return orders
+}
+
+// Restore replaces the whole list with orders, keeping their status, history, receipt, version and revision.
+// It is used to rebuild the list from a snapshot and does not validate the orders.
+// Subscribers receive a single reset event and should reload the list, and the audit trail is cleared;
+// RestoreAudit brings back a trail saved with AuditLog.
+func (s *CosmicOrderList) Restore(orders []models.Order) error {
+	type versionKey struct{ orderID, version int }
+	seen := make(map[versionKey]bool, len(orders))
+	for _, order := range orders {
+		key := versionKey{order.OrderID, max(order.Version, 1)}
+		if seen[key] {
+			return fmt.Errorf("restore order #%d version %d: %w", order.OrderID, key.version, ErrDuplicateOrder)
+		}
+		seen[key] = true
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if s.head == nil {
-		return
+	s.head, s.tail, s.length = nil, nil, 0
+	s.index = make(map[int]*models.Order, len(orders))
+	s.versions = make(map[int][]*models.Order)
+	s.byPlanet = make(map[string]orderSet)
+	s.byPizzaType = make(map[string]orderSet)
+	s.audit = newAuditTrail(s.audit.limit)
+	s.queue = newPrepQueue()
+
+	for _, order := range orders {
+		node := detach(&order)
+		node.Version = max(node.Version, 1)
+		node.Revision = max(node.Revision, 1)
+		s.linkAfter(s.tail, &node)
+	}
+	s.emit(models.EventOrdersReset, nil, 0)
+	return nil
+}
+
+// linkAfter links node right after prev, or at the head when prev is nil, indexes it
+// and queues it for the kitchen if it is placed.
+func (s *CosmicOrderList) linkAfter(prev, node *models.Order) {
+	s.insertAfter(prev, node)
+	s.indexID(node)
+	s.indexNode(node)
+	if node.Status == models.StatusPlaced {
+		s.queue.enqueue(node)
 	}
+	s.length++
+}
+
+// unlink removes node from the list, the indexes and the kitchen queue.
+func (s *CosmicOrderList) unlink(node *models.Order) {
+	s.cut(node)
+	s.unindexID(node)
+	s.unindexNode(node)
+	s.queue.dequeue(node)
+	s.length--
+}
 
-	if s.head.OrderID == orderID {
-		s.head = s.head.Next
-		return
+// insertAfter sets the links of node right after prev, or at the head when prev is nil.
+func (s *CosmicOrderList) insertAfter(prev, node *models.Order) {
+	if prev == nil {
+		node.Next = s.head
+		s.head = node
+	} else {
+		node.Next = prev.Next
+		prev.Next = node
 	}
+	node.Prev = prev
 
-	current := s.head
-	for current.Next != nil && current.Next.OrderID != orderID {
-		current = current.Next
+	if node.Next != nil {
+		node.Next.Prev = node
+	} else {
+		s.tail = node
 	}
+}
 
-	if current.Next != nil {
-		current.Next = current.Next.Next
+// cut takes node out of the links of the list.
+func (s *CosmicOrderList) cut(node *models.Order) {
+	if node.Prev != nil {
+		node.Prev.Next = node.Next
+	} else {
+		s.head = node.Next
+	}
+	if node.Next != nil {
+		node.Next.Prev = node.Prev
+	} else {
+		s.tail = node.Prev
+	}
+	node.Next, node.Prev = nil, nil
+}
+
+// nodeAt returns the node at position i, walking from the closer end of the list.
+func (s *CosmicOrderList) nodeAt(i int) *models.Order {
+	if i < s.length/2 {
+		current := s.head
+		for ; i > 0; i-- {
+			current = current.Next
+		}
+		return current
+	}
+
+	current := s.tail
+	for j := s.length - 1; j > i; j-- {
+		current = current.Prev
+	}
+	return current
+}
+
+// newOrder validates the order and creates a placed node from it.
+func (s *CosmicOrderList) newOrder(order models.Order) (*models.Order, error) {
+	items := cloneItems(order.Items)
+	if len(items) == 0 && order.PizzaType != "" {
+		items = []models.LineItem{{PizzaType: order.PizzaType, Size: models.SizeMedium, Quantity: 1}}
+	}
+	if s.menu != nil {
+		if err := s.menu.Validate(items); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	node := &models.Order{
+		OrderID:   order.OrderID,
+		Planet:    order.Planet,
+		Items:     items,
+		Priority:  order.Priority,
+		VIP:       order.VIP,
+		Deadline:  order.Deadline,
+		Version:   1,
+		Revision:  1,
+		ExpiresAt: order.ExpiresAt,
+	}
+	if len(items) > 0 {
+		node.PizzaType = items[0].PizzaType
+	}
+	if node.ExpiresAt.IsZero() {
+		node.ExpiresAt = s.ttl.expiresAt(node.Planet, now)
+	}
+	setStatus(node, models.StatusPlaced, now)
+	return node, nil
+}
+
+// detach returns a copy of the order without its list links.
+func detach(node *models.Order) models.Order {
+	order := *node
+	order.Next, order.Prev = nil, nil
+	order.Items = cloneItems(node.Items)
+	order.History = slices.Clone(node.History)
+	order.Receipt = cloneReceipt(node.Receipt)
+	return order
+}
+
+// cloneItems deep copies line items.
+func cloneItems(items []models.LineItem) []models.LineItem {
+	if items == nil {
+		return nil
+	}
+	cloned := make([]models.LineItem, len(items))
+	for i, item := range items {
+		cloned[i] = item
+		cloned[i].Toppings = slices.Clone(item.Toppings)
 	}
+	return cloned
 }
@@ -0,0 +1,184 @@
+package cosmicorder
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+)
+
+// benchmarkOrders is the number of orders stored before every benchmark.
+const benchmarkOrders = 100000
+
+func TestIndexFollowsList(t *testing.T) {
+	list := NewService()
+	for id := 1; id <= 5; id++ {
+		if err := list.AddOrder(id, "Mars", "Galactic Cheese"); err != nil {
+			t.Fatalf("AddOrder(%d): %v", id, err)
+		}
+	}
+
+	// Remove from the middle, the head and the tail, then append again
+	for _, id := range []int{3, 1, 5} {
+		if err := list.RemoveOrder(id); err != nil {
+			t.Fatalf("RemoveOrder(%d): %v", id, err)
+		}
+		if _, ok := list.Get(id); ok {
+			t.Errorf("Get(%d) found a removed order", id)
+		}
+	}
+	if err := list.AddOrder(6, "Venus", "Nebula Deluxe"); err != nil {
+		t.Fatalf("AddOrder(6): %v", err)
+	}
+
+	want := []int{2, 4, 6}
+	var got []int
+	for _, order := range list.Snapshot() {
+		got = append(got, order.OrderID)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Snapshot = %v, want %v", got, want)
+	}
+	if list.Len() != len(want) {
+		t.Errorf("Len = %d, want %d", list.Len(), len(want))
+	}
+	for _, id := range want {
+		if order, ok := list.Get(id); !ok || order.OrderID != id {
+			t.Errorf("Get(%d) = %+v, %v", id, order, ok)
+		}
+	}
+}
+
+// BenchmarkAddOrder appends one order to a list of benchmarkOrders orders.
+func BenchmarkAddOrder(b *testing.B) {
+	b.Run("indexed", func(b *testing.B) {
+		list := filledList(b)
+		b.ResetTimer()
+		for i := range b.N {
+			list.AddOrder(benchmarkOrders+i+1, "Mars", "Galactic Cheese")
+		}
+	})
+	b.Run("linear", func(b *testing.B) {
+		list := newLinearOrderList(benchmarkOrders)
+		b.ResetTimer()
+		for i := range b.N {
+			list.addOrder(benchmarkOrders+i+1, "Mars", "Galactic Cheese")
+		}
+	})
+}
+
+// BenchmarkGet looks up the newest of benchmarkOrders orders, the worst case for a scan from the head.
+func BenchmarkGet(b *testing.B) {
+	b.Run("indexed", func(b *testing.B) {
+		list := filledList(b)
+		b.ResetTimer()
+		for range b.N {
+			list.Get(benchmarkOrders)
+		}
+	})
+	b.Run("linear", func(b *testing.B) {
+		list := newLinearOrderList(benchmarkOrders)
+		b.ResetTimer()
+		for range b.N {
+			list.get(benchmarkOrders)
+		}
+	})
+}
+
+// BenchmarkRemoveOrder removes the newest of benchmarkOrders orders. The order is put back untimed.
+func BenchmarkRemoveOrder(b *testing.B) {
+	b.Run("indexed", func(b *testing.B) {
+		list := filledList(b)
+		b.ResetTimer()
+		for range b.N {
+			list.RemoveOrder(benchmarkOrders)
+			b.StopTimer()
+			list.AddOrder(benchmarkOrders, "Mars", "Galactic Cheese")
+			b.StartTimer()
+		}
+	})
+	b.Run("linear", func(b *testing.B) {
+		list := newLinearOrderList(benchmarkOrders)
+		b.ResetTimer()
+		for range b.N {
+			list.removeOrder(benchmarkOrders)
+			b.StopTimer()
+			list.addOrder(benchmarkOrders, "Mars", "Galactic Cheese")
+			b.StartTimer()
+		}
+	})
+}
+
+// filledList returns a list holding the orders 1..benchmarkOrders.
+func filledList(b *testing.B) *CosmicOrderList {
+	b.Helper()
+
+	list := NewService()
+	for id := 1; id <= benchmarkOrders; id++ {
+		if err := list.AddOrder(id, "Mars", "Galactic Cheese"); err != nil {
+			b.Fatalf("AddOrder(%d): %v", id, err)
+		}
+	}
+	return list
+}
+
+// linearOrderList is the previous singly linked order list, kept only as a benchmark baseline:
+// append walks to the tail and lookup/removal scan the whole list.
+type linearOrderList struct {
+	head *models.Order
+}
+
+// newLinearOrderList returns a baseline list holding the orders 1..n, built without walking it.
+func newLinearOrderList(n int) *linearOrderList {
+	l := &linearOrderList{}
+	var tail *models.Order
+	for id := 1; id <= n; id++ {
+		order := &models.Order{OrderID: id, Planet: "Mars", PizzaType: "Galactic Cheese"}
+		if tail == nil {
+			l.head = order
+		} else {
+			tail.Next = order
+		}
+		tail = order
+	}
+	return l
+}
+
+func (l *linearOrderList) addOrder(orderID int, planet, pizzaType string) {
+	newOrder := &models.Order{OrderID: orderID, Planet: planet, PizzaType: pizzaType}
+	if l.head == nil {
+		l.head = newOrder
+		return
+	}
+	current := l.head
+	for current.Next != nil {
+		current = current.Next
+	}
+	current.Next = newOrder
+}
+
+func (l *linearOrderList) get(orderID int) (models.Order, bool) {
+	for current := l.head; current != nil; current = current.Next {
+		if current.OrderID == orderID {
+			return *current, true
+		}
+	}
+	return models.Order{}, false
+}
+
+func (l *linearOrderList) removeOrder(orderID int) {
+	if l.head == nil {
+		return
+	}
+	if l.head.OrderID == orderID {
+		l.head = l.head.Next
+		return
+	}
+	current := l.head
+	for current.Next != nil && current.Next.OrderID != orderID {
+		current = current.Next
+	}
+	if current.Next != nil {
+		current.Next = current.Next.Next
+	}
+}
@@ -0,0 +1,53 @@
+package cosmicorder
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+)
+
+// transitions lists the statuses every status may move to.
+// An order can be cancelled until it leaves the kitchen.
+var transitions = map[models.OrderStatus][]models.OrderStatus{
+	models.StatusPlaced:         {models.StatusPreparing, models.StatusCancelled},
+	models.StatusPreparing:      {models.StatusBaking, models.StatusCancelled},
+	models.StatusBaking:         {models.StatusOutForDelivery, models.StatusCancelled},
+	models.StatusOutForDelivery: {models.StatusDelivered},
+	models.StatusDelivered:      {},
+	models.StatusCancelled:      {},
+}
+
+// CanTransition reports whether an order may move from one status to another.
+func CanTransition(from, to models.OrderStatus) bool {
+	return slices.Contains(transitions[from], to)
+}
+
+// Advance moves the order to the given status and records when it happened.
+// It returns ErrOrderNotFound for unknown orders and a *TransitionError for moves
+// the lifecycle does not allow.
+func (s *CosmicOrderList) Advance(orderID int, status models.OrderStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	node, ok := s.index[orderID]
+	if !ok {
+		return fmt.Errorf("advance order #%d: %w", orderID, ErrOrderNotFound)
+	}
+
+	if !CanTransition(node.Status, status) {
+		return &TransitionError{OrderID: orderID, From: node.Status, To: status}
+	}
+	from := node.Status
+	setStatus(node, status, time.Now())
+	s.queue.dequeue(node)
+	s.emit(models.EventStatusChanged, node, from)
+	return nil
+}
+
+// setStatus moves the order to status and appends the change to its history.
+func setStatus(order *models.Order, status models.OrderStatus, at time.Time) {
+	order.Status = status
+	order.History = append(order.History, models.StatusChange{Status: status, At: at})
+}
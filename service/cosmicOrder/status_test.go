@@ -0,0 +1,86 @@
+package cosmicorder
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+)
+
+func TestAdvance(t *testing.T) {
+	// paths are the status changes that bring a placed order to every status
+	paths := map[models.OrderStatus][]models.OrderStatus{
+		models.StatusPlaced:         nil,
+		models.StatusPreparing:      {models.StatusPreparing},
+		models.StatusBaking:         {models.StatusPreparing, models.StatusBaking},
+		models.StatusOutForDelivery: {models.StatusPreparing, models.StatusBaking, models.StatusOutForDelivery},
+		models.StatusDelivered:      {models.StatusPreparing, models.StatusBaking, models.StatusOutForDelivery, models.StatusDelivered},
+		models.StatusCancelled:      {models.StatusCancelled},
+	}
+	allowed := map[[2]models.OrderStatus]bool{
+		{models.StatusPlaced, models.StatusPreparing}:         true,
+		{models.StatusPlaced, models.StatusCancelled}:         true,
+		{models.StatusPreparing, models.StatusBaking}:         true,
+		{models.StatusPreparing, models.StatusCancelled}:      true,
+		{models.StatusBaking, models.StatusOutForDelivery}:    true,
+		{models.StatusBaking, models.StatusCancelled}:         true,
+		{models.StatusOutForDelivery, models.StatusDelivered}: true,
+	}
+
+	for from := models.StatusPlaced; from <= models.StatusCancelled; from++ {
+		for to := models.StatusPlaced; to <= models.StatusCancelled; to++ {
+			t.Run(fmt.Sprintf("%s to %s", from, to), func(t *testing.T) {
+				list := NewService()
+				if err := list.PlaceOrder(models.Order{OrderID: 1, Planet: "Mars", PizzaType: "Galactic Cheese"}); err != nil {
+					t.Fatalf("PlaceOrder: %v", err)
+				}
+				for _, status := range paths[from] {
+					if err := list.Advance(1, status); err != nil {
+						t.Fatalf("Advance(%s): %v", status, err)
+					}
+				}
+				before, _ := list.Get(1)
+
+				allow := allowed[[2]models.OrderStatus{from, to}]
+				if got := CanTransition(from, to); got != allow {
+					t.Errorf("CanTransition = %v, want %v", got, allow)
+				}
+
+				err := list.Advance(1, to)
+				after, _ := list.Get(1)
+				if allow {
+					if err != nil {
+						t.Fatalf("Advance: %v", err)
+					}
+					if after.Status != to || len(after.History) != len(before.History)+1 || after.History[len(after.History)-1].Status != to {
+						t.Errorf("Advance left status %s with history %+v", after.Status, after.History)
+					}
+					return
+				}
+
+				var transition *TransitionError
+				if !errors.As(err, &transition) {
+					t.Fatalf("Advance: got %v, want a *TransitionError", err)
+				}
+				if transition.OrderID != 1 || transition.From != from || transition.To != to {
+					t.Errorf("TransitionError = %+v", transition)
+				}
+				if !errors.Is(err, ErrIllegalTransition) {
+					t.Errorf("Advance: %v does not match ErrIllegalTransition", err)
+				}
+				if after.Status != before.Status || !slices.Equal(after.History, before.History) {
+					t.Errorf("refused transition changed the order: %s %+v, was %s %+v", after.Status, after.History, before.Status, before.History)
+				}
+			})
+		}
+	}
+}
+
+func TestAdvanceUnknownOrder(t *testing.T) {
+	list := NewService()
+	if err := list.Advance(42, models.StatusPreparing); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("Advance: got %v, want ErrOrderNotFound", err)
+	}
+}
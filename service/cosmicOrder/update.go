@@ -0,0 +1,158 @@
+package cosmicorder
+
+import (
+	"fmt"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+	"github.com/gleb-korostelev/CosmicPizza.git/service/menu"
+)
+
+// UpdateOrder edits the planet and the pizza type of an order. The new pizza type replaces
+// the one of the first line item and is validated against the menu; an order without line items
+// returns menu.ErrEmptyOrder. A new planet also gets the expiry of its TTL, counted from placement.
+// Either change drops the receipt, as the order has to be priced again at checkout.
+// A patch that changes nothing returns the order as it is, without a new revision, event or audit entry.
+// If patch.Revision is set and the order was edited since, it returns ErrRevisionConflict;
+// a zero patch.Revision skips the check, so only callers that set it are safe from lost updates.
+func (s *CosmicOrderList) UpdateOrder(orderID int, patch models.OrderPatch) (models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	node, ok := s.index[orderID]
+	if !ok {
+		return models.Order{}, fmt.Errorf("update order #%d: %w", orderID, ErrOrderNotFound)
+	}
+	if patch.Revision != 0 && patch.Revision != node.Revision {
+		return models.Order{}, fmt.Errorf("update order #%d at revision %d (current %d): %w", orderID, patch.Revision, node.Revision, ErrRevisionConflict)
+	}
+
+	updated := detach(node)
+	changed := false
+	if patch.Planet != "" && patch.Planet != updated.Planet {
+		changed = true
+		updated.Planet = patch.Planet
+		updated.Receipt = nil
+		if len(updated.History) > 0 {
+			updated.ExpiresAt = s.ttl.expiresAt(updated.Planet, updated.History[0].At)
+		}
+	}
+	if patch.PizzaType != "" {
+		if len(updated.Items) == 0 {
+			return models.Order{}, fmt.Errorf("update order #%d: %w", orderID, menu.ErrEmptyOrder)
+		}
+		if patch.PizzaType != updated.Items[0].PizzaType || patch.PizzaType != updated.PizzaType {
+			changed = true
+			updated.Receipt = nil
+		}
+		updated.Items[0].PizzaType = patch.PizzaType
+		updated.PizzaType = patch.PizzaType
+		if s.menu != nil {
+			if err := s.menu.Validate(updated.Items); err != nil {
+				return models.Order{}, fmt.Errorf("update order #%d: %w", orderID, err)
+			}
+		}
+	}
+
+	before := detach(node)
+	if !changed {
+		return before, nil
+	}
+	s.overwrite(node, updated)
+	s.emit(models.EventOrderUpdated, node, node.Status)
+
+	after := detach(node)
+	s.record(models.AuditEntry{Action: models.AuditUpdated, OrderID: orderID, Before: &before, After: &after})
+	return after, nil
+}
+
+// MoveOrder moves an order to position index of the list.
+// Placed orders the kitchen considers equal are prepared in list order, so moving one reprioritizes it among them.
+// It returns ErrIndexOutOfRange if index is negative or not smaller than the list.
+func (s *CosmicOrderList) MoveOrder(orderID, index int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	node, ok := s.index[orderID]
+	if !ok {
+		return fmt.Errorf("move order #%d: %w", orderID, ErrOrderNotFound)
+	}
+	if index < 0 || index >= s.length {
+		return fmt.Errorf("move order #%d to %d (length %d): %w", orderID, index, s.length, ErrIndexOutOfRange)
+	}
+
+	entry := s.moveEntry(node)
+	// Positions count the orders without the moved one, so it is taken out first
+	s.cut(node)
+	s.length--
+	var prev *models.Order
+	if index > 0 {
+		prev = s.nodeAt(index - 1)
+	}
+	s.length++
+	s.insertAfter(prev, node)
+
+	s.moved(entry, node)
+	s.queue.reorder(s.head)
+	return nil
+}
+
+// Swap exchanges the positions of two orders. It is recorded as two moves in the audit trail.
+func (s *CosmicOrderList) Swap(a, b int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nodeA, ok := s.index[a]
+	if !ok {
+		return fmt.Errorf("swap orders #%d and #%d: order #%d: %w", a, b, a, ErrOrderNotFound)
+	}
+	nodeB, ok := s.index[b]
+	if !ok {
+		return fmt.Errorf("swap orders #%d and #%d: order #%d: %w", a, b, b, ErrOrderNotFound)
+	}
+	if nodeA == nodeB {
+		return nil
+	}
+
+	entryA, entryB := s.moveEntry(nodeA), s.moveEntry(nodeB)
+	switch {
+	case nodeA.Next == nodeB:
+		s.move(nodeA, nodeB)
+	case nodeB.Next == nodeA:
+		s.move(nodeB, nodeA)
+	default:
+		prevA, prevB := nodeA.Prev, nodeB.Prev
+		s.move(nodeA, prevB)
+		s.move(nodeB, prevA)
+	}
+
+	s.moved(entryA, nodeA)
+	s.moved(entryB, nodeB)
+	s.queue.reorder(s.head)
+	return nil
+}
+
+// move links node right after prev, or at the head when prev is nil.
+func (s *CosmicOrderList) move(node, prev *models.Order) {
+	if node.Prev == prev || node == prev {
+		return
+	}
+	s.cut(node)
+	s.insertAfter(prev, node)
+}
+
+// moveEntry starts the audit entry of a move with the current position of node.
+func (s *CosmicOrderList) moveEntry(node *models.Order) models.AuditEntry {
+	entry := models.AuditEntry{Action: models.AuditMoved, OrderID: node.OrderID}
+	if node.Prev != nil {
+		entry.PrevOrderID, entry.HasPrev = node.Prev.OrderID, true
+	}
+	return entry
+}
+
+// moved emits the event of a moved order and records its audit entry.
+func (s *CosmicOrderList) moved(entry models.AuditEntry, node *models.Order) {
+	s.emit(models.EventOrderMoved, node, node.Status)
+	after := detach(node)
+	entry.After = &after
+	s.record(entry)
+}
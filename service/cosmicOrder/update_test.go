@@ -0,0 +1,123 @@
+package cosmicorder
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+	"github.com/gleb-korostelev/CosmicPizza.git/service/menu"
+	"github.com/gleb-korostelev/CosmicPizza.git/service/pricing"
+)
+
+func TestUpdateOrderDropsReceipt(t *testing.T) {
+	tests := []struct {
+		name        string
+		patch       models.OrderPatch
+		keepReceipt bool
+	}{
+		{name: "new pizza type", patch: models.OrderPatch{PizzaType: "Antimatter Pizza"}},
+		{name: "new planet", patch: models.OrderPatch{Planet: "Venus"}},
+		{name: "same pizza type", patch: models.OrderPatch{PizzaType: "Galactic Cheese"}, keepReceipt: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list := NewService(WithPricer(pricing.Default()))
+			if err := list.PlaceOrder(models.Order{OrderID: 1, Planet: "Mars", PizzaType: "Galactic Cheese"}); err != nil {
+				t.Fatalf("PlaceOrder: %v", err)
+			}
+			if _, err := list.Checkout(1, ""); err != nil {
+				t.Fatalf("Checkout: %v", err)
+			}
+
+			updated, err := list.UpdateOrder(1, tt.patch)
+			if err != nil {
+				t.Fatalf("UpdateOrder: %v", err)
+			}
+			if kept := updated.Receipt != nil; kept != tt.keepReceipt {
+				t.Errorf("receipt kept = %v, want %v", kept, tt.keepReceipt)
+			}
+		})
+	}
+}
+
+func TestUpdateOrderWithoutItems(t *testing.T) {
+	// Only restored orders, e.g. from a snapshot of an older version, can lack line items
+	list := NewService()
+	if err := list.Restore([]models.Order{{OrderID: 1, Planet: "Mars", Status: models.StatusPlaced}}); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+
+	_, err := list.UpdateOrder(1, models.OrderPatch{PizzaType: "Galactic Cheese"})
+	if !errors.Is(err, menu.ErrEmptyOrder) {
+		t.Fatalf("UpdateOrder: got %v, want ErrEmptyOrder", err)
+	}
+	if order, _ := list.Get(1); len(order.Items) != 0 || order.Revision != 1 {
+		t.Errorf("failed update changed the order: %+v", order)
+	}
+}
+
+func TestUpdateOrderWithoutChange(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch models.OrderPatch
+	}{
+		{name: "empty patch"},
+		{name: "same planet", patch: models.OrderPatch{Planet: "Mars"}},
+		{name: "same pizza type", patch: models.OrderPatch{PizzaType: "Galactic Cheese", Revision: 1}},
+		{name: "same planet and pizza type", patch: models.OrderPatch{Planet: "Mars", PizzaType: "Galactic Cheese"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list := NewService()
+			if err := list.PlaceOrder(models.Order{OrderID: 1, Planet: "Mars", PizzaType: "Galactic Cheese"}); err != nil {
+				t.Fatalf("PlaceOrder: %v", err)
+			}
+			events, audit := list.LastEventSeq(), len(list.AuditLog())
+
+			order, err := list.UpdateOrder(1, tt.patch)
+			if err != nil {
+				t.Fatalf("UpdateOrder: %v", err)
+			}
+			if order.Revision != 1 || order.Planet != "Mars" || order.PizzaType != "Galactic Cheese" {
+				t.Errorf("UpdateOrder returned %+v, want the unchanged order at revision 1", order)
+			}
+			if stored, _ := list.Get(1); stored.Revision != 1 {
+				t.Errorf("stored revision %d, want 1", stored.Revision)
+			}
+			if seq := list.LastEventSeq(); seq != events {
+				t.Errorf("UpdateOrder emitted %d events", seq-events)
+			}
+			if n := len(list.AuditLog()); n != audit {
+				t.Errorf("UpdateOrder recorded %d audit entries", n-audit)
+			}
+		})
+	}
+}
+
+func TestUpdateOrderRevision(t *testing.T) {
+	list := NewService()
+	if err := list.PlaceOrder(models.Order{OrderID: 1, Planet: "Mars", PizzaType: "Galactic Cheese"}); err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+	if _, err := list.UpdateOrder(1, models.OrderPatch{Planet: "Venus", Revision: 1}); err != nil {
+		t.Fatalf("UpdateOrder at the current revision: %v", err)
+	}
+
+	// A second edit based on revision 1 lost the race
+	_, err := list.UpdateOrder(1, models.OrderPatch{Planet: "Pluto", Revision: 1})
+	if !errors.Is(err, ErrRevisionConflict) {
+		t.Fatalf("UpdateOrder at a stale revision: got %v, want ErrRevisionConflict", err)
+	}
+	if order, _ := list.Get(1); order.Planet != "Venus" || order.Revision != 2 {
+		t.Errorf("conflicting update changed the order: %+v", order)
+	}
+
+	// Without a revision the edit is applied whatever happened since
+	order, err := list.UpdateOrder(1, models.OrderPatch{Planet: "Pluto"})
+	if err != nil {
+		t.Fatalf("UpdateOrder without a revision: %v", err)
+	}
+	if order.Planet != "Pluto" || order.Revision != 3 {
+		t.Errorf("UpdateOrder returned %+v, want Pluto at revision 3", order)
+	}
+}
@@ -0,0 +1,226 @@
+package fanout
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowPolicy decides what a worker does when its output channel buffer is full.
+type OverflowPolicy int
+
+const (
+	// PolicyBlock waits until the consumer frees a slot in the output channel.
+	PolicyBlock OverflowPolicy = iota
+	// PolicyDrop discards the value and counts it as dropped.
+	PolicyDrop
+	// PolicySpill appends the value to an unbounded overflow queue that is flushed in order.
+	PolicySpill
+)
+
+// Option configures a FanOutService.
+type Option func(*options)
+
+// options holds the FanOutService settings.
+type options struct {
+	bufferSize      int                     // bufferSize is the default output channel capacity.
+	bufferSizes     map[int]int             // bufferSizes overrides the capacity of single outputs.
+	highWatermark   int                     // highWatermark is the queue depth that raises an alert.
+	policy          OverflowPolicy          // policy applies when an output buffer is full.
+	onHighWatermark func(output, depth int) // onHighWatermark is called when an output starts lagging.
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		bufferSizes:     map[int]int{},
+		onHighWatermark: defaultHighWatermarkHandler,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// bufferFor returns the channel capacity of output i.
+func (o options) bufferFor(i int) int {
+	if size, ok := o.bufferSizes[i]; ok {
+		return size
+	}
+	return o.bufferSize
+}
+
+// watermarkFor returns the high watermark of output i.
+// Without an explicit watermark a buffered output alerts when its buffer is full.
+func (o options) watermarkFor(i int) int {
+	if o.highWatermark > 0 {
+		return o.highWatermark
+	}
+	return o.bufferFor(i)
+}
+
+// WithBufferSize sets the capacity of every output channel.
+func WithBufferSize(size int) Option {
+	return func(o *options) {
+		if size >= 0 {
+			o.bufferSize = size
+		}
+	}
+}
+
+// WithOutputBufferSize sets the capacity of the output channel with the given index.
+func WithOutputBufferSize(output, size int) Option {
+	return func(o *options) {
+		if size >= 0 {
+			o.bufferSizes[output] = size
+		}
+	}
+}
+
+// WithHighWatermark sets the number of queued values at which an output is reported as lagging.
+func WithHighWatermark(depth int) Option {
+	return func(o *options) {
+		o.highWatermark = depth
+	}
+}
+
+// WithOverflowPolicy sets what happens when an output buffer is full.
+func WithOverflowPolicy(policy OverflowPolicy) Option {
+	return func(o *options) {
+		o.policy = policy
+	}
+}
+
+// WithHighWatermarkHandler sets the function called when an output starts lagging.
+func WithHighWatermarkHandler(fn func(output, depth int)) Option {
+	return func(o *options) {
+		if fn != nil {
+			o.onHighWatermark = fn
+		}
+	}
+}
+
+// OutputStats holds the counters of a single output channel.
+type OutputStats struct {
+	Sent              uint64 // Sent is the number of values delivered to the channel.
+	Dropped           uint64 // Dropped is the number of values discarded by PolicyDrop.
+	Spilled           uint64 // Spilled is the number of values that found the channel buffer full and waited in the overflow queue.
+	Blocked           uint64 // Blocked is the number of sends that had to wait for the consumer.
+	HighWatermarkHits uint64 // HighWatermarkHits is the number of times the output started lagging.
+	Depth             int    // Depth is the number of values currently buffered in the channel.
+	Overflow          int    // Overflow is the number of values currently in the overflow queue.
+}
+
+// output is a single output channel together with its counters and overflow queue.
+type output[T any] struct {
+	index     int
+	ch        chan T
+	watermark int
+
+	sent    atomic.Uint64
+	dropped atomic.Uint64
+	spilled atomic.Uint64
+	blocked atomic.Uint64
+	alerts  atomic.Uint64
+	lagging atomic.Bool
+
+	mu       sync.Mutex
+	overflow []T
+	closing  bool
+	wake     chan struct{}
+}
+
+func newOutput[T any](index, buffer, watermark int) *output[T] {
+	return &output[T]{
+		index:     index,
+		ch:        make(chan T, buffer),
+		watermark: watermark,
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// spill appends the value to the overflow queue and wakes the drainer, which is the only
+// goroutine sending on the channel under PolicySpill, so a shutdown never races a send.
+// The value counts as spilled when it could not go straight into the channel buffer.
+func (o *output[T]) spill(value T) {
+	o.mu.Lock()
+	waiting := len(o.overflow) > 0 || len(o.ch) == cap(o.ch)
+	o.overflow = append(o.overflow, value)
+	o.mu.Unlock()
+
+	if waiting {
+		o.spilled.Add(1)
+	}
+	o.notify()
+}
+
+// front returns the oldest queued value without removing it,
+// and whether the worker has finished feeding the queue.
+func (o *output[T]) front() (value T, ok, closing bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.overflow) == 0 {
+		return value, false, o.closing
+	}
+	return o.overflow[0], true, o.closing
+}
+
+// popFront removes the oldest queued value.
+func (o *output[T]) popFront() {
+	o.mu.Lock()
+	var zero T
+	o.overflow[0] = zero
+	o.overflow = o.overflow[1:]
+	o.mu.Unlock()
+}
+
+// finish marks the queue as complete so the drainer closes the channel once it is empty.
+func (o *output[T]) finish() {
+	o.mu.Lock()
+	o.closing = true
+	o.mu.Unlock()
+	o.notify()
+}
+
+// waitFinished blocks until the worker has called finish, so it no longer feeds the queue.
+func (o *output[T]) waitFinished() {
+	for {
+		o.mu.Lock()
+		closing := o.closing
+		o.mu.Unlock()
+		if closing {
+			return
+		}
+		<-o.wake
+	}
+}
+
+// notify wakes the drainer without blocking.
+func (o *output[T]) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// depth returns the number of values waiting for the consumer.
+func (o *output[T]) depth() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.ch) + len(o.overflow)
+}
+
+func (o *output[T]) stats() OutputStats {
+	o.mu.Lock()
+	overflow := len(o.overflow)
+	o.mu.Unlock()
+
+	return OutputStats{
+		Sent:              o.sent.Load(),
+		Dropped:           o.dropped.Load(),
+		Spilled:           o.spilled.Load(),
+		Blocked:           o.blocked.Load(),
+		HighWatermarkHits: o.alerts.Load(),
+		Depth:             len(o.ch),
+		Overflow:          overflow,
+	}
+}
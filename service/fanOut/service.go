@@ -3,54 +3,171 @@ package fanout
 import (
 	"sync"
 
-	"github.com/gleb-korostelev/CosmicPizza.git/models"
+	"github.com/gleb-korostelev/CosmicPizza.git/tools/logger"
 )
 
-// FanOutService manages multiple workers that process data from an input channel
-type FanOutService struct {
+// FanOutService manages multiple workers that process data from an input channel.
+// T is the element type carried through the service, e.g. models.Task.
+type FanOutService[T any] struct {
 	numWorkers int
-	inputCh    chan models.Task
+	inputCh    chan T
 	doneCh     chan struct{}
-	outputChs  []chan models.Task
+	outputChs  []chan T
+	outputs    []*output[T]
+	opts       options
 	wg         sync.WaitGroup
+	stopOnce   sync.Once
 }
 
 // NewFanOutService initializes a new FanOutService
-func NewFanOutService(inputch chan models.Task, numWorkers int) *FanOutService {
-	fanOut := &FanOutService{
+func NewFanOutService[T any](inputch chan T, numWorkers int, opts ...Option) *FanOutService[T] {
+	fanOut := &FanOutService[T]{
 		numWorkers: numWorkers,
 		inputCh:    inputch,
 		doneCh:     make(chan struct{}),
-		outputChs:  make([]chan models.Task, numWorkers),
+		outputChs:  make([]chan T, numWorkers),
+		outputs:    make([]*output[T], numWorkers),
+		opts:       newOptions(opts),
 	}
 
 	// Create worker goroutines
 	for i := 0; i < numWorkers; i++ {
-		outputCh := make(chan models.Task)
-		fanOut.outputChs[i] = outputCh
-		go fanOut.worker(outputCh)
+		out := newOutput[T](i, fanOut.opts.bufferFor(i), fanOut.opts.watermarkFor(i))
+		fanOut.outputChs[i] = out.ch
+		fanOut.outputs[i] = out
+
+		fanOut.wg.Add(1)
+		go fanOut.worker(out)
+		if fanOut.opts.policy == PolicySpill {
+			fanOut.wg.Add(1)
+			go fanOut.drain(out)
+		}
 	}
 
 	return fanOut
 }
 
 // worker processes data from the input channel and sends it to an output channel
-func (s *FanOutService) worker(outputCh chan models.Task) {
-	defer close(outputCh)
+func (s *FanOutService[T]) worker(out *output[T]) {
+	defer s.wg.Done()
+	defer s.closeOutput(out)
 
-	for task := range s.inputCh {
+	for {
 		select {
 		case <-s.doneCh:
 			// logger.Infof("FanOutService: Stopping worker due to shutdown signal.")
 			return
-		case outputCh <- task:
+		case task, ok := <-s.inputCh:
+			if !ok {
+				return
+			}
+			if !s.send(out, task) {
+				return
+			}
 			// logger.Infof("FanOutService: Task sent to output channel: %+v", task)
 		}
 	}
 }
 
+// send delivers a value to the output according to the overflow policy.
+// It returns false if the service was shut down while waiting.
+func (s *FanOutService[T]) send(out *output[T], value T) bool {
+	s.checkWatermark(out)
+
+	switch s.opts.policy {
+	case PolicyDrop:
+		select {
+		case out.ch <- value:
+			out.sent.Add(1)
+		default:
+			out.dropped.Add(1)
+		}
+		return true
+	case PolicySpill:
+		out.spill(value)
+		return true
+	default:
+		select {
+		case out.ch <- value:
+			out.sent.Add(1)
+			return true
+		default:
+		}
+
+		out.blocked.Add(1)
+		select {
+		case <-s.doneCh:
+			return false
+		case out.ch <- value:
+			out.sent.Add(1)
+			return true
+		}
+	}
+}
+
+// drain moves spilled values from the overflow queue to the output channel in order.
+// It is the only sender on the channel and closes it once the worker has finished:
+// after the queue is flushed, or right away on shutdown, dropping what is still queued.
+func (s *FanOutService[T]) drain(out *output[T]) {
+	defer s.wg.Done()
+	defer close(out.ch)
+
+	for {
+		value, ok, closing := out.front()
+		if !ok {
+			if closing {
+				return
+			}
+			select {
+			case <-s.doneCh:
+				out.waitFinished()
+				return
+			case <-out.wake:
+			}
+			continue
+		}
+
+		select {
+		case <-s.doneCh:
+			out.waitFinished()
+			return
+		case out.ch <- value:
+			out.popFront()
+			out.sent.Add(1)
+		}
+	}
+}
+
+// closeOutput closes the output channel once its worker stops.
+// With the spill policy the channel is closed by the drainer after the overflow queue is flushed.
+func (s *FanOutService[T]) closeOutput(out *output[T]) {
+	if s.opts.policy == PolicySpill {
+		out.finish()
+		return
+	}
+	close(out.ch)
+}
+
+// checkWatermark raises a high-watermark alert when an output crosses its watermark.
+// The alert fires once per crossing and is re-armed when the output drains below it.
+func (s *FanOutService[T]) checkWatermark(out *output[T]) {
+	if out.watermark <= 0 {
+		return
+	}
+
+	depth := out.depth()
+	if depth < out.watermark {
+		out.lagging.Store(false)
+		return
+	}
+	if out.lagging.CompareAndSwap(false, true) {
+		out.alerts.Add(1)
+		s.opts.onHighWatermark(out.index, depth)
+	}
+}
+
 // AddData sends data to the input channel for processing
-func (s *FanOutService) AddData(value models.Task) {
+func (s *FanOutService[T]) AddData(value T) {
 	select {
 	case <-s.doneCh: // If the service is stopped, ignore new data
 		return
@@ -60,14 +177,32 @@ func (s *FanOutService) AddData(value models.Task) {
 }
 
 // GetOutputChannels returns the output channels of the workers
-func (s *FanOutService) GetOutputChannels() []chan models.Task {
+func (s *FanOutService[T]) GetOutputChannels() []chan T {
 	return s.outputChs
 }
 
-// Shutdown gracefully stops all workers and closes channels
-func (s *FanOutService) Shutdown() {
-	close(s.doneCh) // Signal all workers to stop
+// Stats returns the counters of every output channel, in the order of GetOutputChannels.
+func (s *FanOutService[T]) Stats() []OutputStats {
+	stats := make([]OutputStats, len(s.outputs))
+	for i, out := range s.outputs {
+		stats[i] = out.stats()
+	}
+	return stats
+}
+
+// Shutdown stops all workers and waits for them to exit, so every output channel is
+// closed when it returns. A worker blocked on a full output gives up its value, and values
+// still in a spill overflow queue are dropped. It is safe to call Shutdown more than once.
+func (s *FanOutService[T]) Shutdown() {
+	s.stopOnce.Do(func() {
+		close(s.doneCh) // Signal all workers to stop
+	})
 
 	s.wg.Wait() // Wait for all workers to finish
 	// close(s.inputCh)
 }
+
+// defaultHighWatermarkHandler logs lagging consumers.
+func defaultHighWatermarkHandler(output, depth int) {
+	logger.Infof("FanOutService: consumer of output %d is lagging, %d values queued", output, depth)
+}
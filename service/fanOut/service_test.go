@@ -0,0 +1,211 @@
+package fanout
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestSpillShutdownWhileSending shuts the service down while workers are still spilling
+// values and consumers are still reading. Run it with -race: a send on a closed output
+// channel panics, and every output channel must be closed once Shutdown returns.
+func TestSpillShutdownWhileSending(t *testing.T) {
+	for round := 0; round < 50; round++ {
+		input := make(chan int)
+		service := NewFanOutService(input, 4, WithBufferSize(1), WithOverflowPolicy(PolicySpill))
+
+		var consumers sync.WaitGroup
+		for _, ch := range service.GetOutputChannels() {
+			consumers.Add(1)
+			go func(ch chan int) {
+				defer consumers.Done()
+				for range ch {
+				}
+			}(ch)
+		}
+
+		stop := make(chan struct{})
+		var producer sync.WaitGroup
+		producer.Add(1)
+		go func() {
+			defer producer.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				case input <- i:
+				}
+			}
+		}()
+
+		service.Shutdown()
+		close(stop)
+		producer.Wait()
+		consumers.Wait()
+	}
+}
+
+// TestSpillDeliversInOrder checks that a single output keeps the input order when
+// values go through the overflow queue.
+func TestSpillDeliversInOrder(t *testing.T) {
+	input := make(chan int)
+	service := NewFanOutService(input, 1, WithBufferSize(1), WithOverflowPolicy(PolicySpill))
+	out := service.GetOutputChannels()[0]
+
+	const total = 100
+	for i := 0; i < total; i++ {
+		input <- i
+	}
+	close(input)
+
+	next := 0
+	for value := range out {
+		if value != next {
+			t.Fatalf("got %d, want %d", value, next)
+		}
+		next++
+	}
+	if next != total {
+		t.Fatalf("received %d values, want %d", next, total)
+	}
+	service.Shutdown()
+
+	stats := service.Stats()[0]
+	if stats.Sent != total {
+		t.Errorf("Sent = %d, want %d", stats.Sent, total)
+	}
+}
+
+// TestDropCountsDropped fills the buffer of an output nobody reads and checks that
+// the values that did not fit are counted as dropped.
+func TestDropCountsDropped(t *testing.T) {
+	input := make(chan int)
+	service := NewFanOutService(input, 1, WithBufferSize(2), WithOverflowPolicy(PolicyDrop))
+	for i := 0; i < 5; i++ {
+		input <- i
+	}
+	close(input)
+
+	var got []int
+	for value := range service.GetOutputChannels()[0] {
+		got = append(got, value)
+	}
+	service.Shutdown()
+
+	if !slices.Equal(got, []int{0, 1}) {
+		t.Errorf("received %v, want [0 1]", got)
+	}
+	stats := service.Stats()[0]
+	if stats.Sent != 2 || stats.Dropped != 3 || stats.Blocked != 0 {
+		t.Errorf("Sent %d Dropped %d Blocked %d, want 2, 3 and 0", stats.Sent, stats.Dropped, stats.Blocked)
+	}
+}
+
+// TestBlockCountsBlocked makes the worker wait for a slow consumer once.
+func TestBlockCountsBlocked(t *testing.T) {
+	input := make(chan int)
+	service := NewFanOutService(input, 1, WithBufferSize(1), WithHighWatermarkHandler(func(output, depth int) {}))
+	out := service.GetOutputChannels()[0]
+
+	// The worker takes 1 only after 0 is in the buffer, so sending 1 has to wait for the consumer
+	input <- 0
+	input <- 1
+	deadline := time.Now().Add(time.Second)
+	for service.Stats()[0].Blocked == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the worker never blocked on the full output")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for want := 0; want < 2; want++ {
+		if value := <-out; value != want {
+			t.Fatalf("got %d, want %d", value, want)
+		}
+	}
+	close(input)
+	for range out {
+	}
+	service.Shutdown()
+
+	stats := service.Stats()[0]
+	if stats.Sent != 2 || stats.Blocked != 1 || stats.Dropped != 0 {
+		t.Errorf("Sent %d Blocked %d Dropped %d, want 2, 1 and 0", stats.Sent, stats.Blocked, stats.Dropped)
+	}
+}
+
+// TestHighWatermarkRearms checks that the handler fires once while an output stays above
+// its watermark and again after the consumer drained it.
+func TestHighWatermarkRearms(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		depths []int
+	)
+	input := make(chan int)
+	service := NewFanOutService(input, 1, WithBufferSize(4), WithHighWatermark(2), WithOverflowPolicy(PolicyDrop),
+		WithHighWatermarkHandler(func(output, depth int) {
+			mu.Lock()
+			defer mu.Unlock()
+			depths = append(depths, depth)
+		}))
+	out := service.GetOutputChannels()[0]
+
+	// The worker checks the depth before every send and takes a value only after the previous
+	// send, so the depth seen for the n-th value is known: 0 1 2 3 4, then 0 1 2 after draining.
+	// The last value only makes sure the check of the one before it ran before the consumer reads.
+	for i := 0; i < 5; i++ {
+		input <- i
+	}
+	for i := 0; i < 4; i++ {
+		<-out
+	}
+	for i := 5; i < 9; i++ {
+		input <- i
+	}
+	close(input)
+	for range out {
+	}
+	service.Shutdown()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Equal(depths, []int{2, 2}) {
+		t.Errorf("handler called with depths %v, want [2 2]", depths)
+	}
+	if hits := service.Stats()[0].HighWatermarkHits; hits != 2 {
+		t.Errorf("HighWatermarkHits = %d, want 2", hits)
+	}
+}
+
+// TestShutdownWaitsForWorkers shuts down a service whose worker is blocked on an output
+// nobody reads. Shutdown must release it and return with every output channel closed.
+func TestShutdownWaitsForWorkers(t *testing.T) {
+	for _, policy := range []OverflowPolicy{PolicyBlock, PolicyDrop, PolicySpill} {
+		input := make(chan int)
+		service := NewFanOutService(input, 2, WithOverflowPolicy(policy))
+		input <- 1
+
+		done := make(chan struct{})
+		go func() {
+			service.Shutdown()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("policy %d: Shutdown did not return", policy)
+		}
+
+		for i, ch := range service.GetOutputChannels() {
+			select {
+			case _, ok := <-ch:
+				if ok {
+					t.Errorf("policy %d: output %d delivered a value after Shutdown", policy, i)
+				}
+			default:
+				t.Errorf("policy %d: output %d is still open after Shutdown", policy, i)
+			}
+		}
+		service.Shutdown()
+	}
+}
@@ -0,0 +1,85 @@
+package filestore
+
+import (
+	"fmt"
+	"sync"
+
+	ingredienttree "github.com/gleb-korostelev/CosmicPizza.git/service/ingredientTree"
+	"github.com/gleb-korostelev/CosmicPizza.git/service/storage"
+)
+
+var _ storage.IngredientStore = (*IngredientStore)(nil)
+
+// IngredientStore is a file-backed ingredient store.
+type IngredientStore struct {
+	path string
+	tree *ingredienttree.IngredientTree
+
+	mu sync.Mutex // mu serializes mutations so the file always holds the latest state
+}
+
+// NewIngredientStore loads the ingredients stored at path, or starts empty if the file does not exist.
+func NewIngredientStore(path string) (*IngredientStore, error) {
+	s := &IngredientStore{path: path, tree: ingredienttree.NewService()}
+
+	var values []int
+	if err := load(path, &values); err != nil {
+		return nil, fmt.Errorf("load ingredients: %w", err)
+	}
+	if err := s.tree.InsertBatch(values); err != nil {
+		return nil, fmt.Errorf("load ingredients: %w", err)
+	}
+	return s, nil
+}
+
+// Insert adds a single ingredient, then saves the store.
+func (s *IngredientStore) Insert(value int) error {
+	return s.mutate(func() error { return s.tree.Insert(value) })
+}
+
+// InsertBatch adds several ingredients, then saves the store.
+// The values that were inserted are saved even if some of them were duplicates.
+func (s *IngredientStore) InsertBatch(values []int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.tree.InsertBatch(values)
+	if saveErr := save(s.path, s.tree.TraverseInOrder()); saveErr != nil {
+		return fmt.Errorf("save ingredients: %w", saveErr)
+	}
+	return err
+}
+
+// Delete removes a single ingredient, then saves the store.
+func (s *IngredientStore) Delete(value int) error {
+	return s.mutate(func() error { return s.tree.Delete(value) })
+}
+
+// Search reports whether the ingredient is stored.
+func (s *IngredientStore) Search(value int) bool {
+	return s.tree.Search(value)
+}
+
+// TraverseInOrder returns all ingredients in ascending order.
+func (s *IngredientStore) TraverseInOrder() []int {
+	return s.tree.TraverseInOrder()
+}
+
+// FindMinMaxSum returns the smallest and the biggest ingredient and the sum of all of them.
+func (s *IngredientStore) FindMinMaxSum() (min int, max int, sum int) {
+	return s.tree.FindMinMaxSum()
+}
+
+// mutate runs fn and saves the ingredients if it succeeded.
+func (s *IngredientStore) mutate(fn func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := fn(); err != nil {
+		return err
+	}
+	if err := save(s.path, s.tree.TraverseInOrder()); err != nil {
+		return fmt.Errorf("save ingredients: %w", err)
+	}
+	return nil
+}
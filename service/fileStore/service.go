@@ -0,0 +1,222 @@
+// Package filestore implements the storage interfaces on top of the in-memory structures,
+// writing the whole state to a JSON file after every successful mutation.
+// It needs no journal or recovery step, at the cost of rewriting the file on each write,
+// which suits small datasets and tools that want the current state readable on disk.
+package filestore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+	cosmicorder "github.com/gleb-korostelev/CosmicPizza.git/service/cosmicOrder"
+	"github.com/gleb-korostelev/CosmicPizza.git/service/storage"
+	"github.com/gleb-korostelev/CosmicPizza.git/tools/atomicfile"
+)
+
+var (
+	_ storage.AuditedOrderStore  = (*OrderStore)(nil)
+	_ storage.ExpiringOrderStore = (*OrderStore)(nil)
+)
+
+// OrderStore is a file-backed order store.
+// A mutation that succeeds in memory but cannot be written returns the write error;
+// the change stays in memory and is written together with the next successful save.
+// Only the orders are written: the audit trail is not persisted and starts empty on every load.
+type OrderStore struct {
+	path   string
+	orders *cosmicorder.CosmicOrderList
+
+	mu sync.Mutex // mu serializes mutations so the file always holds the latest state
+}
+
+// NewOrderStore loads the orders stored at path, or starts empty if the file does not exist.
+// opts configure the in-memory order list, e.g. its menu and pricer.
+func NewOrderStore(path string, opts ...cosmicorder.Option) (*OrderStore, error) {
+	s := &OrderStore{path: path, orders: cosmicorder.NewService(opts...)}
+
+	var orders []models.Order
+	if err := load(path, &orders); err != nil {
+		return nil, fmt.Errorf("load orders: %w", err)
+	}
+	if err := s.orders.Restore(orders); err != nil {
+		return nil, fmt.Errorf("load orders: %w", err)
+	}
+	return s, nil
+}
+
+// PlaceOrder validates and appends an order, then saves the store.
+func (s *OrderStore) PlaceOrder(order models.Order) error {
+	return s.mutate(func() error { return s.orders.PlaceOrder(order) })
+}
+
+// PlaceOrderAs is PlaceOrder recording actor in the audit trail.
+func (s *OrderStore) PlaceOrderAs(actor string, order models.Order) error {
+	return s.mutate(func() error { return s.orders.PlaceOrderAs(actor, order) })
+}
+
+// RemoveOrderAs is RemoveOrder recording actor in the audit trail.
+func (s *OrderStore) RemoveOrderAs(actor string, orderID int) error {
+	return s.mutate(func() error { return s.orders.RemoveOrderAs(actor, orderID) })
+}
+
+// RemoveOrder removes the order with the given ID, then saves the store.
+func (s *OrderStore) RemoveOrder(orderID int) error {
+	return s.mutate(func() error { return s.orders.RemoveOrder(orderID) })
+}
+
+// Advance moves an order to the next status of its lifecycle, then saves the store.
+func (s *OrderStore) Advance(orderID int, status models.OrderStatus) error {
+	return s.mutate(func() error { return s.orders.Advance(orderID, status) })
+}
+
+// Checkout prices an order and attaches the receipt to it, then saves the store.
+func (s *OrderStore) Checkout(orderID int, promoCode string) (models.Receipt, error) {
+	var receipt models.Receipt
+	err := s.mutate(func() error {
+		var err error
+		receipt, err = s.orders.Checkout(orderID, promoCode)
+		return err
+	})
+	return receipt, err
+}
+
+// AttachReceipt attaches a receipt priced earlier to an order, then saves the store.
+func (s *OrderStore) AttachReceipt(orderID int, receipt models.Receipt) error {
+	return s.mutate(func() error { return s.orders.AttachReceipt(orderID, receipt) })
+}
+
+// UpdateOrder edits the planet and the pizza type of an order, then saves the store.
+func (s *OrderStore) UpdateOrder(orderID int, patch models.OrderPatch) (models.Order, error) {
+	var order models.Order
+	err := s.mutate(func() error {
+		var err error
+		order, err = s.orders.UpdateOrder(orderID, patch)
+		return err
+	})
+	return order, err
+}
+
+// MoveOrder moves an order to another position, then saves the store.
+func (s *OrderStore) MoveOrder(orderID, index int) error {
+	return s.mutate(func() error { return s.orders.MoveOrder(orderID, index) })
+}
+
+// Swap exchanges the positions of two orders, then saves the store.
+func (s *OrderStore) Swap(a, b int) error {
+	return s.mutate(func() error { return s.orders.Swap(a, b) })
+}
+
+// NextToPrepare takes the most urgent placed order and moves it to Preparing, then saves the store.
+func (s *OrderStore) NextToPrepare() (models.Order, error) {
+	var order models.Order
+	err := s.mutate(func() error {
+		var err error
+		order, err = s.orders.NextToPrepare()
+		return err
+	})
+	return order, err
+}
+
+// Expire cancels or removes the placed orders that expired by now, then saves the store.
+func (s *OrderStore) Expire(now time.Time) ([]models.Order, error) {
+	var expired []models.Order
+	err := s.mutate(func() error {
+		var err error
+		expired, err = s.orders.Expire(now)
+		return err
+	})
+	return expired, err
+}
+
+// ExpireOrders expires the listed placed orders whether they are due or not, then saves the store.
+func (s *OrderStore) ExpireOrders(now time.Time, orderIDs []int) ([]models.Order, error) {
+	var expired []models.Order
+	err := s.mutate(func() error {
+		var err error
+		expired, err = s.orders.ExpireOrders(now, orderIDs)
+		return err
+	})
+	return expired, err
+}
+
+// Restore replaces all orders, then saves the store.
+func (s *OrderStore) Restore(orders []models.Order) error {
+	return s.mutate(func() error { return s.orders.Restore(orders) })
+}
+
+// Get returns the order with the given ID.
+func (s *OrderStore) Get(orderID int) (models.Order, bool) {
+	return s.orders.Get(orderID)
+}
+
+// Len returns the number of orders.
+func (s *OrderStore) Len() int {
+	return s.orders.Len()
+}
+
+// Snapshot returns a copy of all orders in placement order.
+func (s *OrderStore) Snapshot() []models.Order {
+	return s.orders.Snapshot()
+}
+
+// All returns an iterator over the orders in placement order.
+func (s *OrderStore) All() iter.Seq[models.Order] {
+	return s.orders.All()
+}
+
+// CountByPlanet returns the number of orders per planet.
+func (s *OrderStore) CountByPlanet() map[string]int {
+	return s.orders.CountByPlanet()
+}
+
+// CountByPizzaType returns the number of orders containing each pizza type.
+func (s *OrderStore) CountByPizzaType() map[string]int {
+	return s.orders.CountByPizzaType()
+}
+
+// mutate runs fn and saves the orders if it succeeded.
+func (s *OrderStore) mutate(fn func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := fn(); err != nil {
+		return err
+	}
+	if err := save(s.path, s.orders.Snapshot()); err != nil {
+		return fmt.Errorf("save orders: %w", err)
+	}
+	return nil
+}
+
+// load decodes the JSON file at path into v and creates its directory if needed.
+// A missing file leaves v untouched.
+func load(path string, v any) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// save encodes v as JSON and atomically replaces the file at path.
+func save(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return atomicfile.Write(path, data)
+}
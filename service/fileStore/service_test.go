@@ -0,0 +1,48 @@
+package filestore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+)
+
+// blockSave makes every later save of the file at path fail by putting a non-empty directory in its place.
+func blockSave(t *testing.T, path string) {
+	t.Helper()
+
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("remove %s: %v", path, err)
+	}
+	if err := os.MkdirAll(filepath.Join(path, "blocked"), 0o755); err != nil {
+		t.Fatalf("block %s: %v", path, err)
+	}
+}
+
+func TestMutationsReturnSaveErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orders.json")
+	store, err := NewOrderStore(path)
+	if err != nil {
+		t.Fatalf("NewOrderStore: %v", err)
+	}
+	for id := 1; id <= 2; id++ {
+		if err := store.PlaceOrder(models.Order{OrderID: id, Planet: "Mars", PizzaType: "Galactic Cheese"}); err != nil {
+			t.Fatalf("place order #%d: %v", id, err)
+		}
+	}
+	blockSave(t, path)
+
+	order, err := store.NextToPrepare()
+	if err == nil {
+		t.Fatal("NextToPrepare returned no error although the store could not be saved")
+	}
+	if got, _ := store.Get(order.OrderID); got.Status != models.StatusPreparing {
+		t.Errorf("order #%d is %s in memory, want %s", order.OrderID, got.Status, models.StatusPreparing)
+	}
+
+	if _, err := store.ExpireOrders(time.Now(), []int{2}); err == nil {
+		t.Error("ExpireOrders returned no error although the store could not be saved")
+	}
+}
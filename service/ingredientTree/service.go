@@ -1,54 +1,137 @@
 package ingredienttree
 
 import (
+	"errors"
+	"fmt"
+	"slices"
 	"sync"
+	"sync/atomic"
 
-	"github.com/gleb-korostelev/CosmicPizza.git/tools/logger"
+	"github.com/gleb-korostelev/CosmicPizza.git/service/storage"
 )
 
-// IngredientTree represents a binary search tree for ingredients
+var _ storage.IngredientStore = (*IngredientTree)(nil)
+
+// Errors returned by the ingredient tree.
+var (
+	// ErrDuplicateIngredient is returned when the ingredient is already in the tree.
+	ErrDuplicateIngredient = errors.New("duplicate ingredient")
+
+	// ErrIngredientNotFound is returned when the ingredient to delete is not in the tree.
+	ErrIngredientNotFound = errors.New("ingredient not found")
+
+	// ErrInvalidTree is returned by Validate when the tree breaks an invariant.
+	ErrInvalidTree = errors.New("invalid ingredient tree")
+)
+
+// IngredientTree represents an AVL tree of unique ingredients.
+// The heights of the two subtrees of every node differ by at most one,
+// so insert, search and delete are O(log n) whatever the insertion order.
+//
+// The tree is copy-on-write: nodes are never changed once published. Writers are serialized,
+// copy the path from the root to the changed node and publish the new root atomically, so
+// readers take no lock and always see a consistent version of the whole tree.
 type IngredientTree struct {
-	value int
-	left  *IngredientTree
-	right *IngredientTree
-	mu    sync.Mutex
+	current atomic.Pointer[version] // current is the latest published version, nil while empty
+	mu      sync.Mutex              // mu serializes writers
+}
+
+// version is an immutable state of the tree.
+type version struct {
+	root *node
+	size int
+}
+
+// node is a single ingredient of the tree.
+type node struct {
+	value  int
+	height int // height of the subtree rooted at the node, 1 for a leaf
+	left   *node
+	right  *node
 }
 
 func NewService() *IngredientTree {
 	return &IngredientTree{}
 }
 
-// Insert adds a new ingredient to the tree
-func (s *IngredientTree) Insert(value int) {
+// load returns the latest version of the tree.
+func (s *IngredientTree) load() version {
+	if v := s.current.Load(); v != nil {
+		return *v
+	}
+	return version{}
+}
+
+// Insert adds a new ingredient to the tree.
+// It returns ErrDuplicateIngredient if the value is already in the tree.
+func (s *IngredientTree) Insert(value int) error {
 	if s == nil {
-		return
+		return nil
 	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// If tree is empty or default initialized (0 root), replace it with the first inserted value
-	if s.value == 0 && s.left == nil && s.right == nil {
-		s.value = value
-		return
+	v := s.load()
+	if err := v.insert(value); err != nil {
+		return err
 	}
+	s.current.Store(&v)
+	return nil
+}
 
-	if value < s.value {
-		if s.left == nil {
-			s.left = &IngredientTree{value: value}
-		} else {
-			s.left.Insert(value)
-		}
-	} else if value > s.value {
-		if s.right == nil {
-			s.right = &IngredientTree{value: value}
-		} else {
-			s.right.Insert(value)
-		}
-	} else if value == s.value {
-		logger.Infof("Value is already in the tree")
+// InsertBatch adds several ingredients at once. Readers see either none or all of them.
+// Every value is attempted; the errors of the values that could not be inserted are joined.
+// A value repeated within the batch is inserted once and its repeats return ErrDuplicateIngredient.
+func (s *IngredientTree) InsertBatch(values []int) error {
+	if s == nil {
+		return nil
+	}
+
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v := s.load()
+	var errs []error
+	for _, value := range sorted {
+		errs = append(errs, v.insert(value))
+	}
+	s.current.Store(&v)
+	return errors.Join(errs...)
+}
+
+// insert adds value to the version, copying the nodes it changes.
+func (v *version) insert(value int) error {
+	root, inserted := insertNode(v.root, value)
+	if !inserted {
+		return fmt.Errorf("insert ingredient %d: %w", value, ErrDuplicateIngredient)
+	}
+	v.root = root
+	v.size++
+	return nil
+}
 
+// Delete removes an ingredient from the tree.
+// A node with two children is replaced by its in-order successor.
+// It returns ErrIngredientNotFound if the value is not in the tree.
+func (s *IngredientTree) Delete(value int) error {
+	if s == nil {
+		return fmt.Errorf("delete ingredient %d: %w", value, ErrIngredientNotFound)
 	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v := s.load()
+	root, deleted := deleteNode(v.root, value)
+	if !deleted {
+		return fmt.Errorf("delete ingredient %d: %w", value, ErrIngredientNotFound)
+	}
+	s.current.Store(&version{root: root, size: v.size - 1})
+	return nil
 }
 
 // Search checks if an ingredient exists
@@ -57,13 +140,18 @@ func (s *IngredientTree) Search(value int) bool {
 		return false
 	}
 
-	if value < s.value {
-		return s.left.Search(value)
-	} else if value > s.value {
-		return s.right.Search(value)
+	current := s.load().root
+	for current != nil {
+		switch {
+		case value < current.value:
+			current = current.left
+		case value > current.value:
+			current = current.right
+		default:
+			return true
+		}
 	}
-
-	return true
+	return false
 }
 
 // TraverseInOrder returns sorted ingredient values
@@ -71,47 +159,226 @@ func (s *IngredientTree) TraverseInOrder() []int {
 	if s == nil {
 		return []int{}
 	}
-	var result []int
-	if s.left != nil {
-		result = append(result, s.left.TraverseInOrder()...)
+
+	v := s.load()
+	return appendInOrder(make([]int, 0, v.size), v.root)
+}
+
+// appendInOrder appends the values of the subtree rooted at n in ascending order.
+func appendInOrder(values []int, n *node) []int {
+	if n == nil {
+		return values
 	}
-	result = append(result, s.value)
-	if s.right != nil {
-		result = append(result, s.right.TraverseInOrder()...)
+	values = appendInOrder(values, n.left)
+	values = append(values, n.value)
+	return appendInOrder(values, n.right)
+}
+
+// Len returns the number of ingredients in the tree.
+func (s *IngredientTree) Len() int {
+	if s == nil {
+		return 0
+	}
+
+	return s.load().size
+}
+
+// Height returns the height of the tree, 0 when it is empty.
+func (s *IngredientTree) Height() int {
+	if s == nil {
+		return 0
 	}
-	return result
+
+	return height(s.load().root)
 }
 
 // FindMinMaxSum finds the minimum, maximum, and sum of all ingredients in the tree.
+// All three are 0 when the tree is empty.
 func (s *IngredientTree) FindMinMaxSum() (min int, max int, sum int) {
 	if s == nil {
 		return 0, 0, 0
 	}
 
+	// Read a single version so the three results agree
+	root := s.load().root
+	if root == nil {
+		return 0, 0, 0
+	}
+
 	// Finding minimum value (leftmost node)
-	current := s
+	current := root
 	for current.left != nil {
 		current = current.left
 	}
 	min = current.value
 
 	// Finding maximum value (rightmost node)
-	current = s
+	current = root
 	for current.right != nil {
 		current = current.right
 	}
 	max = current.value
 
 	// Calculating the sum of all values
-	sum = s.calculateSum()
+	sum = calculateSum(root)
 
 	return min, max, sum
 }
 
-// calculateSum recursively sums up all values in the tree.
-func (s *IngredientTree) calculateSum() int {
+// calculateSum recursively sums up all values of the subtree rooted at n.
+func calculateSum(n *node) int {
+	if n == nil {
+		return 0
+	}
+	return n.value + calculateSum(n.left) + calculateSum(n.right)
+}
+
+// Validate checks the invariants of the tree: values are strictly ordered, every node stores
+// the height of its subtree, subtree heights differ by at most one and the size matches.
+// It returns an error wrapping ErrInvalidTree that names the first broken invariant.
+func (s *IngredientTree) Validate() error {
 	if s == nil {
+		return nil
+	}
+
+	v := s.load()
+	count, err := validate(v.root, nil, nil)
+	if err != nil {
+		return err
+	}
+	if count != v.size {
+		return fmt.Errorf("tree holds %d ingredients but counts %d: %w", count, v.size, ErrInvalidTree)
+	}
+	return nil
+}
+
+// validate checks the subtree rooted at n, whose values must lie strictly between lo and hi
+// when they are set, and returns the number of its nodes.
+func validate(n *node, lo, hi *int) (int, error) {
+	if n == nil {
+		return 0, nil
+	}
+	if (lo != nil && n.value <= *lo) || (hi != nil && n.value >= *hi) {
+		return 0, fmt.Errorf("ingredient %d is out of order: %w", n.value, ErrInvalidTree)
+	}
+	if want := 1 + max(height(n.left), height(n.right)); n.height != want {
+		return 0, fmt.Errorf("ingredient %d stores height %d instead of %d: %w", n.value, n.height, want, ErrInvalidTree)
+	}
+	if b := balance(n); b < -1 || b > 1 {
+		return 0, fmt.Errorf("ingredient %d has balance %d: %w", n.value, b, ErrInvalidTree)
+	}
+
+	left, err := validate(n.left, lo, &n.value)
+	if err != nil {
+		return 0, err
+	}
+	right, err := validate(n.right, &n.value, hi)
+	if err != nil {
+		return 0, err
+	}
+	return left + right + 1, nil
+}
+
+// insertNode returns a copy of the subtree rooted at n with value added, rebalanced.
+// Only the nodes on the path to the new leaf are copied. It reports false if the value is already in the subtree.
+func insertNode(n *node, value int) (*node, bool) {
+	if n == nil {
+		return newNode(value, nil, nil), true
+	}
+
+	switch {
+	case value < n.value:
+		left, inserted := insertNode(n.left, value)
+		if !inserted {
+			return n, false
+		}
+		return balanced(n.value, left, n.right), true
+	case value > n.value:
+		right, inserted := insertNode(n.right, value)
+		if !inserted {
+			return n, false
+		}
+		return balanced(n.value, n.left, right), true
+	}
+	return n, false
+}
+
+// deleteNode returns a copy of the subtree rooted at n without value, rebalanced.
+// It reports false if the value is not in the subtree.
+func deleteNode(n *node, value int) (*node, bool) {
+	if n == nil {
+		return nil, false
+	}
+
+	switch {
+	case value < n.value:
+		left, deleted := deleteNode(n.left, value)
+		if !deleted {
+			return n, false
+		}
+		return balanced(n.value, left, n.right), true
+	case value > n.value:
+		right, deleted := deleteNode(n.right, value)
+		if !deleted {
+			return n, false
+		}
+		return balanced(n.value, n.left, right), true
+	}
+
+	if n.left == nil {
+		return n.right, true
+	}
+	if n.right == nil {
+		return n.left, true
+	}
+	// Two children: the successor takes the place of the node and leaves the right subtree
+	successor := n.right
+	for successor.left != nil {
+		successor = successor.left
+	}
+	right, _ := deleteNode(n.right, successor.value)
+	return balanced(successor.value, n.left, right), true
+}
+
+// balanced returns a new node holding value over left and right, rotated if the heights
+// of left and right differ by two. Existing nodes are reused, never changed.
+func balanced(value int, left, right *node) *node {
+	switch b := height(left) - height(right); {
+	case b > 1:
+		if height(left.left) < height(left.right) {
+			// Left-right case: the inner grandchild becomes the root
+			inner := left.right
+			return newNode(inner.value, newNode(left.value, left.left, inner.left), newNode(value, inner.right, right))
+		}
+		return newNode(left.value, left.left, newNode(value, left.right, right))
+	case b < -1:
+		if height(right.right) < height(right.left) {
+			// Right-left case: the inner grandchild becomes the root
+			inner := right.left
+			return newNode(inner.value, newNode(value, left, inner.left), newNode(right.value, inner.right, right.right))
+		}
+		return newNode(right.value, newNode(value, left, right.left), right.right)
+	}
+	return newNode(value, left, right)
+}
+
+// newNode creates a node over left and right with its height.
+func newNode(value int, left, right *node) *node {
+	return &node{value: value, height: 1 + max(height(left), height(right)), left: left, right: right}
+}
+
+// height returns the height of the subtree rooted at n, 0 for an empty one.
+func height(n *node) int {
+	if n == nil {
+		return 0
+	}
+	return n.height
+}
+
+// balance returns the height of the left subtree of n minus the height of its right subtree.
+func balance(n *node) int {
+	if n == nil {
 		return 0
 	}
-	return s.value + s.left.calculateSum() + s.right.calculateSum()
+	return height(n.left) - height(n.right)
 }
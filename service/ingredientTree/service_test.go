@@ -0,0 +1,330 @@
+package ingredienttree
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	leaf := func(value int) *node { return newNode(value, nil, nil) }
+	tests := []struct {
+		name  string
+		root  *node
+		size  int
+		valid bool
+	}{
+		{name: "empty", valid: true},
+		{name: "balanced", root: newNode(2, leaf(1), leaf(3)), size: 3, valid: true},
+		{name: "left leaning", root: newNode(3, newNode(2, leaf(1), nil), leaf(4)), size: 4, valid: true},
+		{name: "left child too big", root: newNode(2, leaf(3), nil), size: 2},
+		{name: "grandchild on the wrong side", root: newNode(5, newNode(2, nil, leaf(7)), leaf(8)), size: 4},
+		{name: "duplicate value", root: newNode(2, leaf(2), nil), size: 2},
+		{name: "stale height", root: &node{value: 2, height: 1, left: leaf(1)}, size: 2},
+		{name: "unbalanced", root: newNode(1, nil, newNode(2, nil, leaf(3))), size: 3},
+		{name: "size too small", root: newNode(2, leaf(1), leaf(3)), size: 2},
+		{name: "size too big", root: leaf(1), size: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := NewService()
+			tree.current.Store(&version{root: tt.root, size: tt.size})
+
+			err := tree.Validate()
+			if tt.valid && err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidTree) {
+				t.Fatalf("Validate: got %v, want ErrInvalidTree", err)
+			}
+		})
+	}
+}
+
+func TestInsertKeepsBalance(t *testing.T) {
+	const n = 1 << 12
+	tests := []struct {
+		name   string
+		values []int
+	}{
+		{name: "sorted", values: sortedValues(n)},
+		{name: "reversed", values: reversed(sortedValues(n))},
+		{name: "random", values: randomValues(n)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := NewService()
+			for _, value := range tt.values {
+				if err := tree.Insert(value); err != nil {
+					t.Fatalf("Insert(%d): %v", value, err)
+				}
+			}
+			if err := tree.Validate(); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			// An AVL tree of n nodes is at most about 1.44 log2(n) high
+			if limit := int(1.45*math.Log2(n)) + 1; tree.Height() > limit {
+				t.Errorf("height %d of %d ingredients exceeds %d", tree.Height(), n, limit)
+			}
+			if tree.Len() != n {
+				t.Errorf("Len = %d, want %d", tree.Len(), n)
+			}
+		})
+	}
+}
+
+func TestDelete(t *testing.T) {
+	//          50
+	//        /    \
+	//      30      80
+	//     /  \    /  \
+	//    20  40  70  90
+	//   /
+	//  10
+	initial := []int{50, 30, 80, 20, 40, 70, 90, 10}
+	tests := []struct {
+		name     string
+		value    int
+		children int // children of the deleted node, -1 if it is not in the tree
+	}{
+		{name: "leaf", value: 40, children: 0},
+		{name: "one child", value: 20, children: 1},
+		{name: "two children", value: 80, children: 2},
+		{name: "root", value: 50, children: 2},
+		{name: "missing", value: 60, children: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := NewService()
+			for _, value := range initial {
+				if err := tree.Insert(value); err != nil {
+					t.Fatalf("Insert(%d): %v", value, err)
+				}
+			}
+			if got := children(tree.load().root, tt.value); got != tt.children {
+				t.Fatalf("ingredient %d has %d children before the delete, want %d", tt.value, got, tt.children)
+			}
+			want := slices.Sorted(slices.Values(initial))
+
+			err := tree.Delete(tt.value)
+			if tt.children < 0 {
+				if !errors.Is(err, ErrIngredientNotFound) {
+					t.Fatalf("Delete(%d): got %v, want ErrIngredientNotFound", tt.value, err)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Delete(%d): %v", tt.value, err)
+				}
+				want = slices.DeleteFunc(want, func(value int) bool { return value == tt.value })
+			}
+
+			if err := tree.Validate(); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if tree.Search(tt.value) {
+				t.Errorf("Search(%d) found the deleted ingredient", tt.value)
+			}
+			if got := tree.TraverseInOrder(); !slices.Equal(got, want) {
+				t.Errorf("TraverseInOrder = %v, want %v", got, want)
+			}
+			if tree.Len() != len(want) {
+				t.Errorf("Len = %d, want %d", tree.Len(), len(want))
+			}
+		})
+	}
+}
+
+// children returns the number of children of the node holding value, or -1 if there is none.
+func children(n *node, value int) int {
+	for n != nil && n.value != value {
+		if value < n.value {
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	if n == nil {
+		return -1
+	}
+	count := 0
+	for _, child := range []*node{n.left, n.right} {
+		if child != nil {
+			count++
+		}
+	}
+	return count
+}
+
+func BenchmarkInsertSorted(b *testing.B) {
+	benchmarkInsert(b, sortedValues(b.N))
+}
+
+func BenchmarkInsertRandom(b *testing.B) {
+	benchmarkInsert(b, randomValues(b.N))
+}
+
+// benchmarkInsert inserts every value into an empty tree.
+func benchmarkInsert(b *testing.B, values []int) {
+	tree := NewService()
+	b.ResetTimer()
+	for _, value := range values {
+		tree.Insert(value)
+	}
+}
+
+// sortedValues returns 1..n in ascending order.
+func sortedValues(n int) []int {
+	values := make([]int, n)
+	for i := range values {
+		values[i] = i + 1
+	}
+	return values
+}
+
+// reversed reverses values in place and returns them.
+func reversed(values []int) []int {
+	slices.Reverse(values)
+	return values
+}
+
+// randomValues returns 1..n in random order.
+func randomValues(n int) []int {
+	values := rand.Perm(n)
+	for i := range values {
+		values[i]++
+	}
+	return values
+}
+
+// TestConcurrentReadersWriters lets writers insert and delete random ingredients while readers
+// search, traverse and validate the tree. Every read must see a whole version of the tree: sorted,
+// balanced and with a size matching its content. Run it with -race to check that readers need no lock.
+func TestInsertBatch(t *testing.T) {
+	tree := NewService()
+	if err := tree.Insert(5); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+
+	// 5 is already stored and 3 is given twice: both are reported, the other values go in
+	err := tree.InsertBatch([]int{3, 5, 7, 3, 9})
+	if !errors.Is(err, ErrDuplicateIngredient) {
+		t.Fatalf("InsertBatch: got %v, want ErrDuplicateIngredient", err)
+	}
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok || len(joined.Unwrap()) != 2 {
+		t.Errorf("InsertBatch: got %v, want one error per duplicate", err)
+	}
+	if got, want := tree.TraverseInOrder(), []int{3, 5, 7, 9}; !slices.Equal(got, want) {
+		t.Errorf("TraverseInOrder = %v, want %v", got, want)
+	}
+	if err := tree.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+
+	if err := tree.InsertBatch([]int{1, 2}); err != nil {
+		t.Errorf("InsertBatch without duplicates: %v", err)
+	}
+}
+
+// TestInsertBatchIsAtomic inserts batches of batchSize new values while readers check
+// that they never see part of a batch.
+func TestInsertBatchIsAtomic(t *testing.T) {
+	const (
+		batches   = 200
+		batchSize = 10
+		readers   = 4
+	)
+
+	tree := NewService()
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for range readers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if n := len(tree.TraverseInOrder()); n%batchSize != 0 {
+					t.Errorf("reader saw %d values, part of a batch", n)
+					return
+				}
+			}
+		}()
+	}
+
+	for i := range batches {
+		batch := make([]int, batchSize)
+		for j := range batch {
+			batch[j] = j*batches + i
+		}
+		if err := tree.InsertBatch(batch); err != nil {
+			t.Fatalf("InsertBatch: %v", err)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	if tree.Len() != batches*batchSize {
+		t.Errorf("Len = %d, want %d", tree.Len(), batches*batchSize)
+	}
+}
+
+func TestConcurrentReadersWriters(t *testing.T) {
+	const (
+		writers    = 8
+		readers    = 8
+		operations = 2000
+		maxValue   = 100
+	)
+	if testing.Short() {
+		t.Skip("stress test")
+	}
+
+	tree := NewService()
+	var wg sync.WaitGroup
+	for range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range operations {
+				value := rand.Intn(maxValue) + 1
+				if rand.Intn(2) == 0 {
+					tree.Insert(value)
+				} else {
+					tree.Delete(value)
+				}
+			}
+		}()
+	}
+	for range readers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range operations {
+				tree.Search(rand.Intn(maxValue) + 1)
+				values := tree.TraverseInOrder()
+				min, max, _ := tree.FindMinMaxSum()
+				if err := tree.Validate(); err != nil {
+					t.Errorf("Validate: %v", err)
+					return
+				}
+				if !slices.IsSorted(values) || min > max {
+					t.Errorf("inconsistent read: traversal %v, min %d, max %d", values, min, max)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := tree.Validate(); err != nil {
+		t.Fatalf("Validate after the run: %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+// Package menu describes what Cosmic Pizza sells: pizza types, sizes and the
+// ingredient catalog extra toppings are drawn from. It validates order line items
+// against that menu.
+package menu
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+)
+
+// Default menu content
+var (
+	PizzaTypes = []string{"BlackHole Pepperoni", "Galactic Cheese", "Quantum Anchoa", "Nebula Deluxe", "Supernova Supreme", "Dark Matter Veggie", "Antimatter Pizza"}
+	Sizes      = []models.PizzaSize{models.SizeSmall, models.SizeMedium, models.SizeLarge, models.SizeGalactic}
+	Toppings   = []string{"Stardust Mozzarella", "Meteor Mushrooms", "Comet Olives", "Solar Basil", "Plasma Peppers", "Lunar Ham", "Wormhole Jalapenos"}
+)
+
+// MaxQuantity is the largest quantity accepted for a single line item.
+const MaxQuantity = 100
+
+// Errors returned by Validate.
+var (
+	ErrEmptyOrder       = errors.New("order has no line items")
+	ErrUnknownPizzaType = errors.New("unknown pizza type")
+	ErrUnknownSize      = errors.New("unknown size")
+	ErrUnknownTopping   = errors.New("unknown topping")
+	ErrInvalidQuantity  = errors.New("invalid quantity")
+)
+
+// Menu holds the pizza types, sizes and toppings that can be ordered.
+type Menu struct {
+	pizzaTypes []string
+	sizes      []models.PizzaSize
+	toppings   []string
+}
+
+// NewService creates a menu with the given content.
+func NewService(pizzaTypes []string, sizes []models.PizzaSize, toppings []string) *Menu {
+	return &Menu{
+		pizzaTypes: slices.Clone(pizzaTypes),
+		sizes:      slices.Clone(sizes),
+		toppings:   slices.Clone(toppings),
+	}
+}
+
+// Default returns the standard Cosmic Pizza menu.
+func Default() *Menu {
+	return NewService(PizzaTypes, Sizes, Toppings)
+}
+
+// PizzaTypes returns the pizza types on the menu.
+func (m *Menu) PizzaTypes() []string {
+	return slices.Clone(m.pizzaTypes)
+}
+
+// Sizes returns the sizes on the menu.
+func (m *Menu) Sizes() []models.PizzaSize {
+	return slices.Clone(m.sizes)
+}
+
+// Toppings returns the extra toppings of the ingredient catalog.
+func (m *Menu) Toppings() []string {
+	return slices.Clone(m.toppings)
+}
+
+// Validate checks every line item against the menu.
+func (m *Menu) Validate(items []models.LineItem) error {
+	if len(items) == 0 {
+		return ErrEmptyOrder
+	}
+
+	for i, item := range items {
+		if err := m.validateItem(item); err != nil {
+			return fmt.Errorf("line item %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// validateItem checks a single line item against the menu.
+func (m *Menu) validateItem(item models.LineItem) error {
+	if !slices.Contains(m.pizzaTypes, item.PizzaType) {
+		return fmt.Errorf("%w %q", ErrUnknownPizzaType, item.PizzaType)
+	}
+	if !slices.Contains(m.sizes, item.Size) {
+		return fmt.Errorf("%w %q", ErrUnknownSize, item.Size)
+	}
+	if item.Quantity < 1 || item.Quantity > MaxQuantity {
+		return fmt.Errorf("%w %d", ErrInvalidQuantity, item.Quantity)
+	}
+	for _, topping := range item.Toppings {
+		if !slices.Contains(m.toppings, topping) {
+			return fmt.Errorf("%w %q", ErrUnknownTopping, topping)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package menu
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+)
+
+func TestValidate(t *testing.T) {
+	item := func(pizzaType string, size models.PizzaSize, quantity int, toppings ...string) models.LineItem {
+		return models.LineItem{PizzaType: pizzaType, Size: size, Quantity: quantity, Toppings: toppings}
+	}
+	tests := []struct {
+		name    string
+		items   []models.LineItem
+		wantErr error
+	}{
+		{name: "single item", items: []models.LineItem{item("Galactic Cheese", models.SizeMedium, 1)}},
+		{name: "several items with toppings", items: []models.LineItem{
+			item("Nebula Deluxe", models.SizeGalactic, 2, "Solar Basil", "Lunar Ham"),
+			item("Antimatter Pizza", models.SizeSmall, 1),
+		}},
+		{name: "largest quantity", items: []models.LineItem{item("Galactic Cheese", models.SizeLarge, MaxQuantity)}},
+		{name: "nil items", wantErr: ErrEmptyOrder},
+		{name: "no items", items: []models.LineItem{}, wantErr: ErrEmptyOrder},
+		{name: "unknown pizza type", items: []models.LineItem{item("Earth Margherita", models.SizeMedium, 1)}, wantErr: ErrUnknownPizzaType},
+		{name: "unknown size", items: []models.LineItem{item("Galactic Cheese", "Tiny", 1)}, wantErr: ErrUnknownSize},
+		{name: "unknown topping", items: []models.LineItem{item("Galactic Cheese", models.SizeMedium, 1, "Pineapple")}, wantErr: ErrUnknownTopping},
+		{name: "zero quantity", items: []models.LineItem{item("Galactic Cheese", models.SizeMedium, 0)}, wantErr: ErrInvalidQuantity},
+		{name: "negative quantity", items: []models.LineItem{item("Galactic Cheese", models.SizeMedium, -1)}, wantErr: ErrInvalidQuantity},
+		{name: "quantity above the maximum", items: []models.LineItem{item("Galactic Cheese", models.SizeMedium, MaxQuantity+1)}, wantErr: ErrInvalidQuantity},
+		{name: "bad second item", items: []models.LineItem{
+			item("Galactic Cheese", models.SizeMedium, 1),
+			item("Earth Margherita", models.SizeMedium, 1),
+		}, wantErr: ErrUnknownPizzaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Default().Validate(tt.items)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Validate: got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewServiceCopiesContent(t *testing.T) {
+	pizzaTypes := []string{"Galactic Cheese"}
+	m := NewService(pizzaTypes, Sizes, Toppings)
+	pizzaTypes[0] = "Earth Margherita"
+
+	if err := m.Validate([]models.LineItem{{PizzaType: "Galactic Cheese", Size: models.SizeMedium, Quantity: 1}}); err != nil {
+		t.Errorf("Validate after the caller changed its slice: %v", err)
+	}
+}
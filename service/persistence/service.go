@@ -0,0 +1,387 @@
+// Package persistence keeps the order list and the ingredient tree on disk.
+//
+// Every successful mutation is appended to a write-ahead log (WAL) before it is acknowledged;
+// mutations that fail are not logged, so recovery never replays them. Periodic snapshots
+// store the full state and compact the log. On startup Recover loads the latest snapshot
+// and replays the log entries written after it, so both structures survive a crash.
+// Mutations replayed from the log get the recovery time as their timestamps; state captured
+// by a snapshot keeps its original timestamps.
+package persistence
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+	"github.com/gleb-korostelev/CosmicPizza.git/service/storage"
+	"github.com/gleb-korostelev/CosmicPizza.git/tools/atomicfile"
+	"github.com/gleb-korostelev/CosmicPizza.git/tools/logger"
+)
+
+const (
+	walFile      = "wal.log"
+	snapshotFile = "snapshot.json"
+)
+
+// ErrNotRecovered is returned when the store is used before Recover.
+var ErrNotRecovered = errors.New("persistence store is not recovered")
+
+// ErrClosed is returned when the store is used after Close.
+var ErrClosed = errors.New("persistence store is closed")
+
+// ErrCorruptWAL is returned by Recover when a WAL record other than the last one cannot be decoded.
+var ErrCorruptWAL = errors.New("corrupt WAL record")
+
+// SyncPolicy decides when the WAL is flushed to stable storage with fsync.
+type SyncPolicy int
+
+const (
+	// SyncAlways fsyncs after every record. Nothing acknowledged is ever lost.
+	SyncAlways SyncPolicy = iota
+	// SyncInterval fsyncs periodically. A crash loses at most one interval of records.
+	SyncInterval
+	// SyncNever leaves flushing to the operating system.
+	SyncNever
+)
+
+// Option configures a Store.
+type Option func(*options)
+
+type options struct {
+	syncPolicy       SyncPolicy
+	syncInterval     time.Duration
+	snapshotInterval time.Duration
+}
+
+// WithSyncPolicy sets the fsync policy. interval is used by SyncInterval.
+func WithSyncPolicy(policy SyncPolicy, interval time.Duration) Option {
+	return func(o *options) {
+		o.syncPolicy = policy
+		o.syncInterval = interval
+	}
+}
+
+// WithSnapshotInterval sets how often a compacted snapshot is written. Zero disables periodic snapshots.
+func WithSnapshotInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.snapshotInterval = interval
+	}
+}
+
+// record is a single WAL entry.
+type record struct {
+	Seq  uint64      `json:"seq"`
+	Task models.Task `json:"task"`
+}
+
+// snapshot is the full persisted state up to the WAL entry Seq.
+type snapshot struct {
+	Seq         uint64              `json:"seq"`
+	CreatedAt   time.Time           `json:"createdAt"`
+	Orders      []models.Order      `json:"orders"`
+	Audit       []models.AuditEntry `json:"audit,omitempty"` // Audit is the audit trail of order stores that can revert changes
+	Ingredients []int               `json:"ingredients"`
+}
+
+// Store is a file-backed persistence layer for the order list and the ingredient tree.
+// It implements utils.Journal and closer.Closer.
+type Store struct {
+	dir  string
+	opts options
+
+	mu     sync.Mutex // mu serializes commits, snapshots and syncs
+	wal    *os.File
+	seq    uint64
+	dirty  bool // dirty is set when records were written since the last fsync
+	closed bool
+
+	orders      storage.OrderStore
+	ingredients storage.IngredientStore
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Open creates the data directory if needed. Call Recover before committing mutations.
+func Open(dir string, opts ...Option) (*Store, error) {
+	o := options{syncPolicy: SyncAlways, syncInterval: time.Second}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("open persistence store: %w", err)
+	}
+	return &Store{dir: dir, opts: o, done: make(chan struct{})}, nil
+}
+
+// Recover rebuilds orders and ingredients from the latest snapshot and the WAL entries
+// written after it, then starts the background sync and snapshot loops.
+// apply re-executes a logged mutation; only successful mutations are logged, so its errors
+// point at a state that diverged from the log and are logged without stopping recovery.
+func (s *Store) Recover(orders storage.OrderStore, ingredients storage.IngredientStore, apply func(models.Task) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap, err := s.readSnapshot()
+	if err != nil {
+		return err
+	}
+	if err := orders.Restore(snap.Orders); err != nil {
+		return fmt.Errorf("recover orders: %w", err)
+	}
+	if revertible, ok := orders.(storage.RevertibleOrderStore); ok {
+		if err := revertible.RestoreAudit(snap.Audit); err != nil {
+			return fmt.Errorf("recover audit trail: %w", err)
+		}
+	}
+	if err := ingredients.InsertBatch(snap.Ingredients); err != nil {
+		logger.Errorf("Persistence: recovering ingredients: %v", err)
+	}
+	s.seq = snap.Seq
+
+	replayed, err := s.replayWAL(apply)
+	if err != nil {
+		return err
+	}
+
+	s.orders, s.ingredients = orders, ingredients
+	logger.Infof("Persistence: recovered %d orders, %d ingredients and %d WAL records from %s",
+		len(snap.Orders), len(snap.Ingredients), replayed, s.dir)
+
+	if s.opts.syncPolicy == SyncInterval && s.opts.syncInterval > 0 {
+		s.every(s.opts.syncInterval, s.sync)
+	}
+	if s.opts.snapshotInterval > 0 {
+		s.every(s.opts.snapshotInterval, s.Snapshot)
+	}
+	return nil
+}
+
+// Commit runs apply and appends the task to the WAL if it succeeded. apply may record in
+// the task what it resolved, e.g. the receipt of a checkout, so the replay does not depend
+// on the state or the clock at recovery. Mutations are serialized so the log order is the
+// order they were applied in. If the record cannot be written the mutation stays applied
+// in memory and the write error is returned.
+func (s *Store) Commit(task models.Task, apply func(task *models.Task) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.usable(); err != nil {
+		return err
+	}
+	if err := apply(&task); err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(record{Seq: s.seq + 1, Task: task})
+	if err != nil {
+		return fmt.Errorf("encode WAL record: %w", err)
+	}
+	if _, err := s.wal.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write WAL record: %w", err)
+	}
+	s.seq++
+	s.dirty = true
+
+	if s.opts.syncPolicy == SyncAlways {
+		return s.syncLocked()
+	}
+	return nil
+}
+
+// Snapshot writes the full state to disk and truncates the WAL.
+func (s *Store) Snapshot() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.usable(); err != nil {
+		return err
+	}
+	return s.snapshotLocked()
+}
+
+// Close writes a final snapshot, stops the background loops and closes the WAL.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+
+	var err error
+	if s.wal != nil {
+		err = errors.Join(s.snapshotLocked(), s.wal.Close())
+	}
+	s.closed = true
+	close(s.done)
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+// usable reports whether the store can accept writes.
+func (s *Store) usable() error {
+	if s.closed {
+		return ErrClosed
+	}
+	if s.wal == nil {
+		return ErrNotRecovered
+	}
+	return nil
+}
+
+// snapshotLocked writes the snapshot atomically, then starts a new empty WAL.
+func (s *Store) snapshotLocked() error {
+	snap := snapshot{
+		Seq:         s.seq,
+		CreatedAt:   time.Now(),
+		Orders:      s.orders.Snapshot(),
+		Ingredients: s.ingredients.TraverseInOrder(),
+	}
+	// Undo and revert tasks are replayed against the trail, so it is saved with the orders
+	if revertible, ok := s.orders.(storage.RevertibleOrderStore); ok {
+		snap.Audit = revertible.AuditLog()
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("encode snapshot: %w", err)
+	}
+	if err := atomicfile.Write(filepath.Join(s.dir, snapshotFile), data); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+
+	if err := s.wal.Truncate(0); err != nil {
+		return fmt.Errorf("compact WAL: %w", err)
+	}
+	if _, err := s.wal.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("compact WAL: %w", err)
+	}
+	return s.syncLocked()
+}
+
+// sync flushes the WAL to stable storage if records were written since the last sync.
+func (s *Store) sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed || !s.dirty {
+		return nil
+	}
+	return s.syncLocked()
+}
+
+func (s *Store) syncLocked() error {
+	if err := s.wal.Sync(); err != nil {
+		return fmt.Errorf("sync WAL: %w", err)
+	}
+	s.dirty = false
+	return nil
+}
+
+// readSnapshot loads the snapshot file. A missing file is an empty state.
+func (s *Store) readSnapshot() (snapshot, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, snapshotFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return snapshot{}, nil
+	}
+	if err != nil {
+		return snapshot{}, fmt.Errorf("read snapshot: %w", err)
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return snapshot{}, fmt.Errorf("decode snapshot: %w", err)
+	}
+	return snap, nil
+}
+
+// replayWAL applies the WAL records newer than the snapshot and opens the WAL for appending.
+// A torn record at the end of the log, left by a crash in the middle of a write, is cut off.
+// A record that cannot be decoded but is followed by more data is not a torn write: the log
+// is left untouched and ErrCorruptWAL is returned, as cutting it off would drop valid records.
+func (s *Store) replayWAL(apply func(models.Task) error) (int, error) {
+	wal, err := os.OpenFile(filepath.Join(s.dir, walFile), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return 0, fmt.Errorf("open WAL: %w", err)
+	}
+
+	var (
+		replayed int
+		valid    int64
+	)
+	reader := bufio.NewReader(wal)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				logger.Errorf("Persistence: dropping torn WAL record at offset %d", valid)
+			}
+			break
+		}
+		if err != nil {
+			wal.Close()
+			return 0, fmt.Errorf("read WAL: %w", err)
+		}
+
+		var rec record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			if _, peekErr := reader.Peek(1); !errors.Is(peekErr, io.EOF) {
+				wal.Close()
+				return 0, fmt.Errorf("WAL record at offset %d: %w: %v", valid, ErrCorruptWAL, err)
+			}
+			logger.Errorf("Persistence: dropping corrupt WAL tail at offset %d: %v", valid, err)
+			break
+		}
+		valid += int64(len(line))
+		if rec.Seq <= s.seq {
+			continue
+		}
+
+		if err := apply(rec.Task); err != nil {
+			logger.Errorf("Persistence: replaying WAL record %d: %v", rec.Seq, err)
+		}
+		s.seq = rec.Seq
+		replayed++
+	}
+
+	if err := wal.Truncate(valid); err != nil {
+		wal.Close()
+		return 0, fmt.Errorf("truncate WAL: %w", err)
+	}
+	if _, err := wal.Seek(valid, io.SeekStart); err != nil {
+		wal.Close()
+		return 0, fmt.Errorf("seek WAL: %w", err)
+	}
+	s.wal = wal
+	return replayed, nil
+}
+
+// every runs fn at every interval until the store is closed.
+func (s *Store) every(interval time.Duration, fn func() error) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+				if err := fn(); err != nil && !errors.Is(err, ErrClosed) {
+					logger.Errorf("Persistence: %v", err)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,308 @@
+package persistence_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+	cosmicorder "github.com/gleb-korostelev/CosmicPizza.git/service/cosmicOrder"
+	ingredienttree "github.com/gleb-korostelev/CosmicPizza.git/service/ingredientTree"
+	"github.com/gleb-korostelev/CosmicPizza.git/service/persistence"
+	"github.com/gleb-korostelev/CosmicPizza.git/service/pricing"
+	"github.com/gleb-korostelev/CosmicPizza.git/utils"
+)
+
+// open recovers the state stored in dir into fresh structures priced at now.
+// Snapshots are disabled, so everything after the first run is replayed from the WAL.
+func open(t *testing.T, dir string, now time.Time, opts ...cosmicorder.Option) (*persistence.Store, *cosmicorder.CosmicOrderList) {
+	t.Helper()
+
+	orders := cosmicorder.NewService(append(opts, cosmicorder.WithPricer(pricing.NewService(pricing.DefaultPriceList(),
+		pricing.WithPromoCodes(pricing.DefaultPromoCodes...), pricing.WithClock(func() time.Time { return now }))))...)
+	ingredients := ingredienttree.NewService()
+
+	store, err := persistence.Open(dir, persistence.WithSyncPolicy(persistence.SyncAlways, 0))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	err = store.Recover(orders, ingredients, func(task models.Task) error {
+		return utils.SwitchProcessTasks(context.Background(), task, orders, ingredients, nil)
+	})
+	if err != nil {
+		t.Fatalf("Recover: %v", err)
+	}
+	return store, orders
+}
+
+// walRecords returns the number of records in the WAL of dir.
+func walRecords(t *testing.T, dir string) int {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join(dir, "wal.log"))
+	if err != nil {
+		t.Fatalf("read WAL: %v", err)
+	}
+	return bytes.Count(data, []byte("\n"))
+}
+
+func TestCommitJournalsOnlySuccessfulMutations(t *testing.T) {
+	dir := t.TempDir()
+	store, orders := open(t, dir, time.Now())
+	defer store.Close()
+
+	err := utils.SwitchProcessTasks(context.Background(), models.Task{Type: utils.RemoveOrderTask, OrderID: 1}, orders, nil, store)
+	if !errors.Is(err, cosmicorder.ErrOrderNotFound) {
+		t.Fatalf("removing a missing order: got %v, want ErrOrderNotFound", err)
+	}
+	if n := walRecords(t, dir); n != 0 {
+		t.Fatalf("failed mutation wrote %d WAL records, want 0", n)
+	}
+
+	add := models.Task{Type: utils.AddOrderTask, OrderID: 1, OrderPayload: models.OrderPayload{Planet: "Mars", PizzaType: "Galactic Cheese"}}
+	if err := utils.SwitchProcessTasks(context.Background(), add, orders, nil, store); err != nil {
+		t.Fatalf("add order: %v", err)
+	}
+	if n := walRecords(t, dir); n != 1 {
+		t.Fatalf("successful mutation wrote %d WAL records, want 1", n)
+	}
+
+	unchanged := models.Task{Type: utils.UpdateOrderTask, OrderID: 1, OrderPayload: models.OrderPayload{Planet: "Mars"}}
+	if err := utils.SwitchProcessTasks(context.Background(), unchanged, orders, nil, store); err != nil {
+		t.Fatalf("update order: %v", err)
+	}
+	if n := walRecords(t, dir); n != 1 {
+		t.Fatalf("update without change wrote %d WAL records, want none", n-1)
+	}
+}
+
+func TestRecoverAttachesJournaledReceipt(t *testing.T) {
+	dir := t.TempDir()
+	checkedOutAt := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	store, orders := open(t, dir, checkedOutAt)
+	tasks := []models.Task{
+		{Type: utils.AddOrderTask, OrderID: 1, OrderPayload: models.OrderPayload{Planet: "Mars", PizzaType: "Galactic Cheese"}},
+		{Type: utils.CheckoutOrderTask, OrderID: 1, CheckoutPayload: models.CheckoutPayload{PromoCode: "BIGBANG10"}},
+	}
+	for _, task := range tasks {
+		if err := utils.SwitchProcessTasks(context.Background(), task, orders, nil, store); err != nil {
+			t.Fatalf("task %d: %v", task.Type, err)
+		}
+	}
+	want, _ := orders.Get(1)
+
+	// Recover an hour later without closing the first store, as after a crash
+	recovered, orders := open(t, dir, checkedOutAt.Add(time.Hour))
+	defer recovered.Close()
+
+	got, ok := orders.Get(1)
+	if !ok || got.Receipt == nil {
+		t.Fatalf("recovered order #1 = %+v, want it checked out", got)
+	}
+	if !got.Receipt.IssuedAt.Equal(want.Receipt.IssuedAt) || got.Receipt.Total != want.Receipt.Total {
+		t.Errorf("recovered receipt issued at %s for %s, want %s for %s",
+			got.Receipt.IssuedAt, got.Receipt.Total, want.Receipt.IssuedAt, want.Receipt.Total)
+	}
+}
+
+func TestRecoverRepeatsExpiry(t *testing.T) {
+	dir := t.TempDir()
+	ttl := cosmicorder.WithTTL(cosmicorder.TTLPolicy{Default: time.Minute})
+
+	store, orders := open(t, dir, time.Now(), ttl)
+	for id := 1; id <= 2; id++ {
+		add := models.Task{Type: utils.AddOrderTask, OrderID: id, OrderPayload: models.OrderPayload{Planet: "Mars", PizzaType: "Galactic Cheese"}}
+		if err := utils.SwitchProcessTasks(context.Background(), add, orders, nil, store); err != nil {
+			t.Fatalf("add order #%d: %v", id, err)
+		}
+	}
+	first, _ := orders.Get(1)
+	if err := orders.Advance(2, models.StatusPreparing); err != nil {
+		t.Fatalf("advance order #2: %v", err)
+	}
+
+	expire := utils.ExpireOrders(orders, store)
+	expired, err := expire(first.ExpiresAt)
+	if err != nil || len(expired) != 1 || expired[0].OrderID != 1 {
+		t.Fatalf("expire = %v, %v; want order #1", expired, err)
+	}
+	records := walRecords(t, dir)
+	if _, err := expire(first.ExpiresAt.Add(time.Minute)); err != nil {
+		t.Fatalf("expire again: %v", err)
+	}
+	if n := walRecords(t, dir); n != records {
+		t.Errorf("expiry run without expired orders wrote %d WAL records", n-records)
+	}
+
+	// Order #2 was advanced without the journal, so only the logged expiry may cancel order #1
+	recovered, orders := open(t, dir, time.Now(), ttl)
+	defer recovered.Close()
+
+	got, _ := orders.Get(1)
+	if got.Status != models.StatusCancelled {
+		t.Errorf("recovered order #1 is %s, want %s", got.Status, models.StatusCancelled)
+	}
+	if !got.ExpiresAt.Equal(first.ExpiresAt) {
+		t.Errorf("recovered order #1 expires at %s, want %s", got.ExpiresAt, first.ExpiresAt)
+	}
+	if got, _ := orders.Get(2); got.Status != models.StatusPlaced {
+		t.Errorf("recovered order #2 is %s, want %s", got.Status, models.StatusPlaced)
+	}
+}
+
+func TestRecoverPreparesJournaledOrder(t *testing.T) {
+	dir := t.TempDir()
+	prepare := models.Task{Type: utils.PrepareOrderTask}
+
+	store, orders := open(t, dir, time.Now())
+	err := utils.SwitchProcessTasks(context.Background(), prepare, orders, nil, store)
+	if !errors.Is(err, cosmicorder.ErrNothingToPrepare) {
+		t.Fatalf("preparing from an empty queue: got %v, want ErrNothingToPrepare", err)
+	}
+
+	add := models.Task{Type: utils.AddOrderTask, OrderID: 1, OrderPayload: models.OrderPayload{Planet: "Mars", PizzaType: "Galactic Cheese"}}
+	if err := utils.SwitchProcessTasks(context.Background(), add, orders, nil, store); err != nil {
+		t.Fatalf("add order #1: %v", err)
+	}
+	// The VIP order jumps the queue but is not journaled, so the queue differs at replay
+	if err := orders.PlaceOrder(models.Order{OrderID: 2, Planet: "Venus", PizzaType: "Galactic Cheese", VIP: true}); err != nil {
+		t.Fatalf("place order #2: %v", err)
+	}
+	if err := utils.SwitchProcessTasks(context.Background(), prepare, orders, nil, store); err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	if n := walRecords(t, dir); n != 2 {
+		t.Fatalf("WAL holds %d records, want the add and the prepare", n)
+	}
+
+	recovered, orders := open(t, dir, time.Now())
+	defer recovered.Close()
+
+	if got, _ := orders.Get(1); got.Status != models.StatusPlaced {
+		t.Errorf("recovered order #1 is %s, want %s: replay prepared another order than the kitchen", got.Status, models.StatusPlaced)
+	}
+}
+
+func TestRecoverRepeatsUndo(t *testing.T) {
+	dir := t.TempDir()
+
+	store, orders := open(t, dir, time.Now())
+	for id := 1; id <= 3; id++ {
+		add := models.Task{Type: utils.AddOrderTask, OrderID: id, OrderPayload: models.OrderPayload{Planet: "Mars", PizzaType: "Galactic Cheese"}}
+		if err := utils.SwitchProcessTasks(context.Background(), add, orders, nil, store); err != nil {
+			t.Fatalf("add order #%d: %v", id, err)
+		}
+	}
+	// The snapshot carries the audit trail the undo below is replayed against
+	if err := store.Snapshot(); err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	undo := models.Task{Type: utils.UndoOrdersTask, Actor: "manager", RevertPayload: models.RevertPayload{Steps: 1}}
+	if err := utils.SwitchProcessTasks(context.Background(), undo, orders, nil, store); err != nil {
+		t.Fatalf("undo: %v", err)
+	}
+	want := orders.AuditLog()
+
+	recovered, orders := open(t, dir, time.Now())
+	defer recovered.Close()
+
+	if _, ok := orders.Get(3); ok {
+		t.Error("recovered order #3 although its placement was undone")
+	}
+	if _, ok := orders.Get(2); !ok {
+		t.Error("recovery lost order #2")
+	}
+	got := orders.AuditLog()
+	if len(got) != len(want) {
+		t.Fatalf("recovered %d audit entries, want %d", len(got), len(want))
+	}
+	for i := range got {
+		if got[i].Seq != want[i].Seq || got[i].Action != want[i].Action || got[i].Undone != want[i].Undone {
+			t.Errorf("recovered audit entry %+v, want %+v", got[i], want[i])
+		}
+	}
+}
+
+func TestRecoverCorruptWAL(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(lines [][]byte) [][]byte // corrupt edits the three WAL lines written by the test
+		orders  int                           // orders is the number of orders recovered, -1 if Recover fails
+	}{
+		{
+			name:    "torn last record",
+			corrupt: func(lines [][]byte) [][]byte { return append(lines, []byte(`{"seq":4,"task":{"Typ`)) },
+			orders:  3,
+		},
+		{
+			name:    "garbage last line",
+			corrupt: func(lines [][]byte) [][]byte { return append(lines, []byte("garbage\n")) },
+			orders:  3,
+		},
+		{
+			name: "garbage in the middle",
+			corrupt: func(lines [][]byte) [][]byte {
+				lines[1] = []byte("garbage\n")
+				return lines
+			},
+			orders: -1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			store, orders := open(t, dir, time.Now())
+			for id := 1; id <= 3; id++ {
+				add := models.Task{Type: utils.AddOrderTask, OrderID: id, OrderPayload: models.OrderPayload{Planet: "Mars", PizzaType: "Galactic Cheese"}}
+				if err := utils.SwitchProcessTasks(context.Background(), add, orders, nil, store); err != nil {
+					t.Fatalf("add order: %v", err)
+				}
+			}
+
+			// Edit the WAL as a crash or a bad disk would, without closing the store
+			path := filepath.Join(dir, "wal.log")
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("read WAL: %v", err)
+			}
+			data = bytes.Join(tt.corrupt(bytes.SplitAfter(data, []byte("\n"))), nil)
+			if err := os.WriteFile(path, data, 0o644); err != nil {
+				t.Fatalf("write WAL: %v", err)
+			}
+
+			recovered, err := persistence.Open(dir)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			defer recovered.Close()
+			orders = cosmicorder.NewService()
+			err = recovered.Recover(orders, ingredienttree.NewService(), func(task models.Task) error {
+				return utils.SwitchProcessTasks(context.Background(), task, orders, nil, nil)
+			})
+
+			if tt.orders < 0 {
+				if !errors.Is(err, persistence.ErrCorruptWAL) {
+					t.Fatalf("Recover: got %v, want ErrCorruptWAL", err)
+				}
+				if after, _ := os.ReadFile(path); !bytes.Equal(after, data) {
+					t.Error("Recover changed a corrupt WAL")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Recover: %v", err)
+			}
+			if orders.Len() != tt.orders {
+				t.Errorf("recovered %d orders, want %d", orders.Len(), tt.orders)
+			}
+			if n := walRecords(t, dir); n != 3 {
+				t.Errorf("WAL holds %d records after recovery, want the 3 valid ones", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+// Package pipeline builds concurrent processing graphs out of sources, stages and sinks.
+// A pipeline is described with a fluent builder and only started when a sink runs it,
+// so the same description can be executed several times. Every execution owns a context
+// that is cancelled as soon as any stage fails, which tears the whole graph down.
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Option configures a single stage of the pipeline.
+type Option func(*stageConfig)
+
+// stageConfig holds per-stage settings.
+type stageConfig struct {
+	name        string // name is used to identify the stage in errors.
+	concurrency int    // concurrency is the number of goroutines running the stage.
+	buffer      int    // buffer is the capacity of the stage output channel.
+}
+
+// WithConcurrency sets the number of goroutines that run the stage.
+func WithConcurrency(n int) Option {
+	return func(c *stageConfig) {
+		if n > 0 {
+			c.concurrency = n
+		}
+	}
+}
+
+// WithBuffer sets the capacity of the stage output channel.
+func WithBuffer(n int) Option {
+	return func(c *stageConfig) {
+		if n >= 0 {
+			c.buffer = n
+		}
+	}
+}
+
+// WithName sets the stage name reported in errors.
+func WithName(name string) Option {
+	return func(c *stageConfig) {
+		c.name = name
+	}
+}
+
+func newStageConfig(name string, opts []Option) stageConfig {
+	cfg := stageConfig{name: name, concurrency: 1}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// run holds the state shared by all stages of one pipeline execution.
+type run struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	wg     sync.WaitGroup
+}
+
+// fail cancels the execution. Only the first error is kept as the cause.
+func (r *run) fail(stage string, err error) {
+	r.cancel(fmt.Errorf("pipeline: stage %q: %w", stage, err))
+}
+
+// spawn starts n workers for a stage and calls finish once all of them returned.
+func (r *run) spawn(n int, work func(), finish func()) {
+	var stage sync.WaitGroup
+	stage.Add(n)
+	r.wg.Add(n + 1)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer r.wg.Done()
+			defer stage.Done()
+			work()
+		}()
+	}
+	go func() {
+		defer r.wg.Done()
+		stage.Wait()
+		if finish != nil {
+			finish()
+		}
+	}()
+}
+
+// send delivers v to ch unless the execution is cancelled first.
+func send[T any](ctx context.Context, ch chan<- T, v T) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case ch <- v:
+		return true
+	}
+}
+
+// each calls fn for every value received from in until in is closed,
+// the execution is cancelled or fn returns false.
+func each[T any](ctx context.Context, in <-chan T, fn func(T) bool) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case v, ok := <-in:
+			if !ok || !fn(v) {
+				return
+			}
+		}
+	}
+}
+
+// Pipeline is a lazily built stream of T values.
+type Pipeline[T any] struct {
+	build func(r *run) <-chan T
+}
+
+// Source creates a pipeline fed by gen. gen must stop when emit returns false.
+func Source[T any](gen func(ctx context.Context, emit func(T) bool) error, opts ...Option) *Pipeline[T] {
+	cfg := newStageConfig("source", opts)
+	return &Pipeline[T]{build: func(r *run) <-chan T {
+		out := make(chan T, cfg.buffer)
+		r.spawn(1, func() {
+			emit := func(v T) bool { return send(r.ctx, out, v) }
+			if err := gen(r.ctx, emit); err != nil {
+				r.fail(cfg.name, err)
+			}
+		}, func() { close(out) })
+		return out
+	}}
+}
+
+// FromSlice creates a pipeline that emits every item of items in order.
+func FromSlice[T any](items []T, opts ...Option) *Pipeline[T] {
+	return Source(func(ctx context.Context, emit func(T) bool) error {
+		for _, item := range items {
+			if !emit(item) {
+				return nil
+			}
+		}
+		return nil
+	}, opts...)
+}
+
+// FromChannel creates a pipeline that emits every value received from ch until it is closed.
+func FromChannel[T any](ch <-chan T, opts ...Option) *Pipeline[T] {
+	return Source(func(ctx context.Context, emit func(T) bool) error {
+		each(ctx, ch, emit)
+		return nil
+	}, opts...)
+}
+
+// Map transforms every value of p with fn, possibly changing its type.
+func Map[In, Out any](p *Pipeline[In], fn func(ctx context.Context, v In) (Out, error), opts ...Option) *Pipeline[Out] {
+	cfg := newStageConfig("map", opts)
+	return &Pipeline[Out]{build: func(r *run) <-chan Out {
+		return mapStage(r, cfg, p.build(r), fn)
+	}}
+}
+
+// Map transforms every value of the pipeline with fn.
+func (p *Pipeline[T]) Map(fn func(ctx context.Context, v T) (T, error), opts ...Option) *Pipeline[T] {
+	return Map(p, fn, opts...)
+}
+
+// Filter keeps only the values for which fn returns true.
+func (p *Pipeline[T]) Filter(fn func(ctx context.Context, v T) (bool, error), opts ...Option) *Pipeline[T] {
+	cfg := newStageConfig("filter", opts)
+	return &Pipeline[T]{build: func(r *run) <-chan T {
+		return filterStage(r, cfg, p.build(r), fn)
+	}}
+}
+
+// FanOut splits the stream into n branches that compete for values.
+// Stages added to the returned Fan run independently on every branch.
+func (p *Pipeline[T]) FanOut(n int) *Fan[T] {
+	if n < 1 {
+		n = 1
+	}
+	return &Fan[T]{build: func(r *run) []<-chan T {
+		in := p.build(r)
+		branches := make([]<-chan T, n)
+		for i := range branches {
+			branches[i] = in
+		}
+		return branches
+	}}
+}
+
+// Sink runs the pipeline and calls fn for every value that reaches the end of it.
+// It blocks until the whole graph has stopped and returns the first error raised
+// by any stage, or the cancellation cause of ctx.
+func (p *Pipeline[T]) Sink(ctx context.Context, fn func(ctx context.Context, v T) error, opts ...Option) error {
+	cfg := newStageConfig("sink", opts)
+	runCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	r := &run{ctx: runCtx, cancel: cancel}
+	in := p.build(r)
+	r.spawn(cfg.concurrency, func() {
+		each(r.ctx, in, func(v T) bool {
+			if err := fn(r.ctx, v); err != nil {
+				r.fail(cfg.name, err)
+				return false
+			}
+			return true
+		})
+	}, nil)
+	r.wg.Wait()
+
+	return context.Cause(runCtx)
+}
+
+// Collect runs the pipeline and returns every value that reached the end of it.
+func (p *Pipeline[T]) Collect(ctx context.Context) ([]T, error) {
+	var (
+		mu     sync.Mutex
+		result []T
+	)
+	err := p.Sink(ctx, func(ctx context.Context, v T) error {
+		mu.Lock()
+		result = append(result, v)
+		mu.Unlock()
+		return nil
+	})
+	return result, err
+}
+
+// Fan is a set of parallel branches created by Pipeline.FanOut.
+type Fan[T any] struct {
+	build func(r *run) []<-chan T
+}
+
+// Map transforms the values of every branch with fn.
+func (f *Fan[T]) Map(fn func(ctx context.Context, v T) (T, error), opts ...Option) *Fan[T] {
+	cfg := newStageConfig("map", opts)
+	return &Fan[T]{build: func(r *run) []<-chan T {
+		branches := f.build(r)
+		out := make([]<-chan T, len(branches))
+		for i, in := range branches {
+			out[i] = mapStage(r, cfg, in, fn)
+		}
+		return out
+	}}
+}
+
+// Filter keeps only the values of every branch for which fn returns true.
+func (f *Fan[T]) Filter(fn func(ctx context.Context, v T) (bool, error), opts ...Option) *Fan[T] {
+	cfg := newStageConfig("filter", opts)
+	return &Fan[T]{build: func(r *run) []<-chan T {
+		branches := f.build(r)
+		out := make([]<-chan T, len(branches))
+		for i, in := range branches {
+			out[i] = filterStage(r, cfg, in, fn)
+		}
+		return out
+	}}
+}
+
+// FanIn merges all branches back into a single pipeline.
+func (f *Fan[T]) FanIn(opts ...Option) *Pipeline[T] {
+	cfg := newStageConfig("fan-in", opts)
+	return &Pipeline[T]{build: func(r *run) <-chan T {
+		branches := f.build(r)
+		out := make(chan T, cfg.buffer)
+
+		var merge sync.WaitGroup
+		merge.Add(len(branches))
+		r.wg.Add(len(branches) + 1)
+		for _, in := range branches {
+			go func(in <-chan T) {
+				defer r.wg.Done()
+				defer merge.Done()
+				each(r.ctx, in, func(v T) bool { return send(r.ctx, out, v) })
+			}(in)
+		}
+		go func() {
+			defer r.wg.Done()
+			merge.Wait()
+			close(out)
+		}()
+		return out
+	}}
+}
+
+// mapStage starts the workers of a map stage and returns its output channel.
+func mapStage[In, Out any](r *run, cfg stageConfig, in <-chan In, fn func(ctx context.Context, v In) (Out, error)) <-chan Out {
+	out := make(chan Out, cfg.buffer)
+	r.spawn(cfg.concurrency, func() {
+		each(r.ctx, in, func(v In) bool {
+			res, err := fn(r.ctx, v)
+			if err != nil {
+				r.fail(cfg.name, err)
+				return false
+			}
+			return send(r.ctx, out, res)
+		})
+	}, func() { close(out) })
+	return out
+}
+
+// filterStage starts the workers of a filter stage and returns its output channel.
+func filterStage[T any](r *run, cfg stageConfig, in <-chan T, fn func(ctx context.Context, v T) (bool, error)) <-chan T {
+	out := make(chan T, cfg.buffer)
+	r.spawn(cfg.concurrency, func() {
+		each(r.ctx, in, func(v T) bool {
+			keep, err := fn(r.ctx, v)
+			if err != nil {
+				r.fail(cfg.name, err)
+				return false
+			}
+			if !keep {
+				return true
+			}
+			return send(r.ctx, out, v)
+		})
+	}, func() { close(out) })
+	return out
+}
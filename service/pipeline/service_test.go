@@ -0,0 +1,130 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var errStage = errors.New("stage failed")
+
+// failOn returns a map function that fails on bad and passes every other value through.
+func failOn(bad int) func(ctx context.Context, v int) (int, error) {
+	return func(ctx context.Context, v int) (int, error) {
+		if v == bad {
+			return 0, errStage
+		}
+		return v, nil
+	}
+}
+
+func TestSinkReturnsStageError(t *testing.T) {
+	values := make([]int, 1000)
+	for i := range values {
+		values[i] = i
+	}
+
+	tests := []struct {
+		name  string
+		run   func(ctx context.Context) error
+		stage string
+	}{
+		{
+			name: "source",
+			run: func(ctx context.Context) error {
+				p := Source(func(ctx context.Context, emit func(int) bool) error {
+					emit(1)
+					return errStage
+				}, WithName("generate"))
+				return p.Sink(ctx, func(context.Context, int) error { return nil })
+			},
+			stage: "generate",
+		},
+		{
+			name: "map",
+			run: func(ctx context.Context) error {
+				p := FromSlice(values).Map(failOn(500), WithName("process"), WithConcurrency(4))
+				return p.Sink(ctx, func(context.Context, int) error { return nil })
+			},
+			stage: "process",
+		},
+		{
+			name: "filter",
+			run: func(ctx context.Context) error {
+				p := FromSlice(values).Filter(func(ctx context.Context, v int) (bool, error) {
+					if v == 500 {
+						return false, errStage
+					}
+					return v%2 == 0, nil
+				}, WithName("even"))
+				return p.Sink(ctx, func(context.Context, int) error { return nil })
+			},
+			stage: "even",
+		},
+		{
+			name: "fan-out branch",
+			run: func(ctx context.Context) error {
+				p := FromSlice(values).FanOut(3).Map(failOn(500), WithName("process")).FanIn()
+				return p.Sink(ctx, func(context.Context, int) error { return nil })
+			},
+			stage: "process",
+		},
+		{
+			name: "window",
+			run: func(ctx context.Context) error {
+				p := Map(TumblingCount(FromSlice(values), 10), func(ctx context.Context, w Window[int]) (int, error) {
+					return failOn(50)(ctx, w.Items[0]/10)
+				}, WithName("aggregate"))
+				return p.Sink(ctx, func(context.Context, int) error { return nil })
+			},
+			stage: "aggregate",
+		},
+		{
+			name: "sink",
+			run: func(ctx context.Context) error {
+				return FromSlice(values).Sink(ctx, func(ctx context.Context, v int) error {
+					_, err := failOn(500)(ctx, v)
+					return err
+				}, WithName("store"))
+			},
+			stage: "store",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.run(context.Background())
+			if !errors.Is(err, errStage) {
+				t.Fatalf("Sink: got %v, want the stage error", err)
+			}
+			if !strings.Contains(err.Error(), `"`+tt.stage+`"`) {
+				t.Errorf("Sink error %q does not name stage %q", err, tt.stage)
+			}
+		})
+	}
+}
+
+func TestSinkReturnsContextCause(t *testing.T) {
+	cause := errors.New("shutting down")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(cause)
+
+	err := FromChannel(make(chan int)).Sink(ctx, func(context.Context, int) error { return nil })
+	if !errors.Is(err, cause) {
+		t.Fatalf("Sink: got %v, want %v", err, cause)
+	}
+}
+
+func TestCollectKeepsOrder(t *testing.T) {
+	got, err := FromSlice([]int{1, 2, 3, 4, 5, 6}).
+		Map(func(ctx context.Context, v int) (int, error) { return v * 10, nil }).
+		Filter(func(ctx context.Context, v int) (bool, error) { return v != 30, nil }).
+		Collect(context.Background())
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	if want := []int{10, 20, 40, 50, 60}; !slices.Equal(got, want) {
+		t.Errorf("Collect = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,199 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+)
+
+// Window is a group of values emitted together by a windowing stage.
+// Start and End are the processing times of the window bounds.
+type Window[T any] struct {
+	Start time.Time
+	End   time.Time
+	Items []T
+}
+
+// stamped is a value together with the time it reached a windowing stage.
+type stamped[T any] struct {
+	at time.Time
+	v  T
+}
+
+// TumblingCount groups the stream into consecutive, non-overlapping windows of size values.
+// The last window may hold fewer values.
+func TumblingCount[T any](p *Pipeline[T], size int, opts ...Option) *Pipeline[Window[T]] {
+	return SlidingCount(p, size, size, opts...)
+}
+
+// SlidingCount emits a window of the last size values every step values.
+// With step greater than size the step-size values between two windows are skipped.
+// Values that arrive after the last full window are flushed as a final, shorter window.
+func SlidingCount[T any](p *Pipeline[T], size, step int, opts ...Option) *Pipeline[Window[T]] {
+	size, step = max(size, 1), max(step, 1)
+	return windowStage(p, "sliding-count", opts, func(ctx context.Context, in <-chan T, emit func(Window[T]) bool) {
+		var buf []stamped[T]
+		fresh, skip := 0, 0
+		flush := func(items []stamped[T]) bool {
+			return emit(newWindow(items, items[0].at, time.Now()))
+		}
+		each(ctx, in, func(v T) bool {
+			if skip > 0 {
+				skip--
+				return true
+			}
+			buf = append(buf, stamped[T]{at: time.Now(), v: v})
+			fresh++
+			if len(buf) < size {
+				return true
+			}
+			fresh = 0
+			if !flush(buf) {
+				return false
+			}
+			skip = max(step-len(buf), 0)
+			buf = append(buf[:0:0], buf[min(step, len(buf)):]...)
+			return true
+		})
+		if fresh > 0 && len(buf) > 0 && ctx.Err() == nil {
+			flush(buf)
+		}
+	})
+}
+
+// TumblingTime groups the stream into consecutive, non-overlapping windows of length size.
+// Empty windows are not emitted.
+func TumblingTime[T any](p *Pipeline[T], size time.Duration, opts ...Option) *Pipeline[Window[T]] {
+	return SlidingTime(p, size, size, opts...)
+}
+
+// SlidingTime emits, every step, a window with the values received during the last size,
+// bounds included. Empty windows are not emitted. With step at least size the windows
+// do not overlap and every value is emitted at most once.
+func SlidingTime[T any](p *Pipeline[T], size, step time.Duration, opts ...Option) *Pipeline[Window[T]] {
+	return windowStage(p, "sliding-time", opts, func(ctx context.Context, in <-chan T, emit func(Window[T]) bool) {
+		ticker := time.NewTicker(step)
+		defer ticker.Stop()
+
+		buf := &timeBuffer[T]{size: size, step: step}
+		flush := func(end time.Time) bool {
+			w, ok := buf.window(end)
+			return !ok || emit(w)
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				if !flush(now) {
+					return
+				}
+			case v, ok := <-in:
+				if !ok {
+					flush(time.Now())
+					return
+				}
+				buf.items = append(buf.items, stamped[T]{at: time.Now(), v: v})
+			}
+		}
+	})
+}
+
+// timeBuffer holds the values of a time window stage in arrival order.
+type timeBuffer[T any] struct {
+	items      []stamped[T]
+	size, step time.Duration
+}
+
+// window returns the values received between end-size and end, and whether there are any.
+// Values received after end, e.g. while the tick was waiting, are left for the next window.
+// It forgets the values no later window can hold.
+func (b *timeBuffer[T]) window(end time.Time) (Window[T], bool) {
+	start := end.Add(-b.size)
+	first := 0
+	for first < len(b.items) && b.items[first].at.Before(start) {
+		first++
+	}
+	last := first
+	for last < len(b.items) && !b.items[last].at.After(end) {
+		last++
+	}
+
+	var w Window[T]
+	ok := last > first
+	if ok {
+		w = newWindow(b.items[first:last], start, end)
+	}
+	if b.step >= b.size {
+		first = last
+	}
+	b.items = b.items[first:]
+	return w, ok
+}
+
+// Session groups values into windows separated by at least gap of inactivity.
+func Session[T any](p *Pipeline[T], gap time.Duration, opts ...Option) *Pipeline[Window[T]] {
+	return windowStage(p, "session", opts, func(ctx context.Context, in <-chan T, emit func(Window[T]) bool) {
+		timer := time.NewTimer(gap)
+		defer timer.Stop()
+
+		var buf []stamped[T]
+		flush := func() bool {
+			if len(buf) == 0 {
+				return true
+			}
+			w := newWindow(buf, buf[0].at, buf[len(buf)-1].at)
+			buf = nil
+			return emit(w)
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+				if !flush() {
+					return
+				}
+			case v, ok := <-in:
+				if !ok {
+					flush()
+					return
+				}
+				buf = append(buf, stamped[T]{at: time.Now(), v: v})
+				timer.Reset(gap)
+			}
+		}
+	})
+}
+
+// CountBy counts the values of items per key, e.g. orders per planet in a window.
+func CountBy[T any, K comparable](items []T, key func(T) K) map[K]int {
+	counts := make(map[K]int)
+	for _, item := range items {
+		counts[key(item)]++
+	}
+	return counts
+}
+
+// windowStage runs a windowing operator in a single goroutine, as windows depend on arrival order.
+func windowStage[T any](p *Pipeline[T], name string, opts []Option, op func(ctx context.Context, in <-chan T, emit func(Window[T]) bool)) *Pipeline[Window[T]] {
+	cfg := newStageConfig(name, opts)
+	return &Pipeline[Window[T]]{build: func(r *run) <-chan Window[T] {
+		in := p.build(r)
+		out := make(chan Window[T], cfg.buffer)
+		r.spawn(1, func() {
+			op(r.ctx, in, func(w Window[T]) bool { return send(r.ctx, out, w) })
+		}, func() { close(out) })
+		return out
+	}}
+}
+
+// newWindow copies the values of items into a new window.
+func newWindow[T any](items []stamped[T], start, end time.Time) Window[T] {
+	w := Window[T]{Start: start, End: end, Items: make([]T, len(items))}
+	for i, item := range items {
+		w.Items[i] = item.v
+	}
+	return w
+}
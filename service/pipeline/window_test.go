@@ -0,0 +1,95 @@
+package pipeline
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSlidingCount(t *testing.T) {
+	tests := []struct {
+		name       string
+		size, step int
+		want       [][]int
+	}{
+		{name: "tumbling", size: 3, step: 3, want: [][]int{{1, 2, 3}, {4, 5, 6}, {7}}},
+		{name: "sliding", size: 3, step: 1, want: [][]int{{1, 2, 3}, {2, 3, 4}, {3, 4, 5}, {4, 5, 6}, {5, 6, 7}}},
+		{name: "step over size", size: 2, step: 3, want: [][]int{{1, 2}, {4, 5}, {7}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			windows, err := SlidingCount(FromSlice([]int{1, 2, 3, 4, 5, 6, 7}), tt.size, tt.step).Collect(context.Background())
+			if err != nil {
+				t.Fatalf("Collect: %v", err)
+			}
+			got := make([][]int, len(windows))
+			for i, w := range windows {
+				got[i] = w.Items
+			}
+			if !slices.EqualFunc(got, tt.want, slices.Equal) {
+				t.Errorf("windows = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeBufferWindow(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(seconds float64) time.Time { return base.Add(time.Duration(seconds * float64(time.Second))) }
+
+	tests := []struct {
+		name       string
+		size, step time.Duration
+		received   []float64 // received holds the arrival times in seconds of the values 0, 1, 2...
+		ends       []float64
+		want       [][]int
+	}{
+		{
+			name: "tumbling", size: 10 * time.Second, step: 10 * time.Second,
+			received: []float64{1, 5, 10, 12, 25},
+			ends:     []float64{10, 20, 30},
+			want:     [][]int{{0, 1, 2}, {3}, {4}},
+		},
+		{
+			name: "value received after the tick", size: 10 * time.Second, step: 10 * time.Second,
+			received: []float64{1, 10.5},
+			ends:     []float64{10, 20},
+			want:     [][]int{{0}, {1}},
+		},
+		{
+			name: "tumbling with a short tick", size: 10 * time.Second, step: 10 * time.Second,
+			received: []float64{1, 10, 12},
+			ends:     []float64{10, 19},
+			want:     [][]int{{0, 1}, {2}},
+		},
+		{
+			name: "sliding", size: 10 * time.Second, step: 5 * time.Second,
+			received: []float64{1, 6, 11},
+			ends:     []float64{10, 15, 20},
+			want:     [][]int{{0, 1}, {1, 2}, {2}},
+		},
+		{
+			name: "step over size", size: 5 * time.Second, step: 10 * time.Second,
+			received: []float64{1, 7, 12},
+			ends:     []float64{10, 20},
+			want:     [][]int{{1}, nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Every value is buffered before the first tick, so each window must skip the later ones
+			buf := &timeBuffer[int]{size: tt.size, step: tt.step}
+			for i, seconds := range tt.received {
+				buf.items = append(buf.items, stamped[int]{at: at(seconds), v: i})
+			}
+
+			for i, end := range tt.ends {
+				w, ok := buf.window(at(end))
+				if ok != (tt.want[i] != nil) || !slices.Equal(w.Items, tt.want[i]) {
+					t.Errorf("window ending at %vs = %v, want %v", end, w.Items, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package pricing
+
+import "github.com/gleb-korostelev/CosmicPizza.git/models"
+
+// DefaultPromoCodes are the promo codes accepted by Default.
+var DefaultPromoCodes = []Promo{
+	{Code: "BIGBANG10", PercentOff: 10},
+	{Code: "ORBIT5", AmountOff: 500},
+}
+
+// DefaultPriceList returns the standard Cosmic Pizza prices.
+func DefaultPriceList() PriceList {
+	return PriceList{
+		BasePrices: map[string]models.Money{
+			"BlackHole Pepperoni": 1299,
+			"Galactic Cheese":     999,
+			"Quantum Anchoa":      1399,
+			"Nebula Deluxe":       1599,
+			"Supernova Supreme":   1699,
+			"Dark Matter Veggie":  1199,
+			"Antimatter Pizza":    2499,
+		},
+		SizeMultipliers: map[models.PizzaSize]int{
+			models.SizeSmall:    75,
+			models.SizeMedium:   100,
+			models.SizeLarge:    130,
+			models.SizeGalactic: 200,
+		},
+		ToppingPrices: map[string]models.Money{
+			"Stardust Mozzarella": 150,
+			"Meteor Mushrooms":    120,
+			"Comet Olives":        100,
+			"Solar Basil":         80,
+			"Plasma Peppers":      110,
+			"Lunar Ham":           180,
+			"Wormhole Jalapenos":  90,
+		},
+		DeliveryFees: map[string]models.Money{
+			"Mars":             499,
+			"Venus":            399,
+			"Jupiter":          999,
+			"Saturn":           1199,
+			"Neptune":          1999,
+			"Pluto":            2499,
+			"Andromeda Nebula": 99999,
+		},
+		TaxRates: map[string]int{
+			"Mars":             800,
+			"Venus":            750,
+			"Jupiter":          1000,
+			"Saturn":           1000,
+			"Neptune":          500,
+			"Pluto":            0,
+			"Andromeda Nebula": 1500,
+		},
+	}
+}
@@ -0,0 +1,43 @@
+package pricing
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+)
+
+// Promo is a fixed promo code granting a percentage or an amount off the subtotal.
+type Promo struct {
+	Code       string
+	PercentOff int          // PercentOff of the subtotal, 0 for none.
+	AmountOff  models.Money // AmountOff the subtotal, 0 for none.
+}
+
+// promoCodes is the Discounter behind WithPromoCodes.
+type promoCodes map[string]Promo
+
+func newPromoCodes(promos []Promo) promoCodes {
+	codes := make(promoCodes, len(promos))
+	for _, promo := range promos {
+		codes[promo.Code] = promo
+	}
+	return codes
+}
+
+// Discounts grants the promo matching code, if any.
+func (p promoCodes) Discounts(order models.Order, receipt models.Receipt, code string, now time.Time) []models.Discount {
+	promo, ok := p[code]
+	if !ok {
+		return nil
+	}
+
+	discount := models.Discount{Code: promo.Code, Amount: promo.AmountOff}
+	if promo.PercentOff > 0 {
+		discount.Amount += Percent(receipt.Subtotal, promo.PercentOff*100)
+		discount.Reason = fmt.Sprintf("%d%% off with code %s", promo.PercentOff, promo.Code)
+	} else {
+		discount.Reason = fmt.Sprintf("%s off with code %s", promo.AmountOff, promo.Code)
+	}
+	return []models.Discount{discount}
+}
@@ -0,0 +1,195 @@
+// Package pricing computes order totals: pizza base prices, size multipliers, topping
+// surcharges, interplanetary delivery fees, taxes and promo codes.
+// All amounts are models.Money, exact integer cents; percentages are rounded half up
+// to the nearest cent.
+package pricing
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+)
+
+// Errors returned by Quote.
+var (
+	ErrUnknownPizzaType       = errors.New("no price for pizza type")
+	ErrUnknownSize            = errors.New("no multiplier for size")
+	ErrUnknownTopping         = errors.New("no price for topping")
+	ErrNoDelivery             = errors.New("no delivery to planet")
+	ErrPromoCodeNotApplicable = errors.New("promo code does not apply")
+)
+
+// PriceList holds every price the engine needs.
+type PriceList struct {
+	BasePrices      map[string]models.Money  // BasePrices of medium pizzas per pizza type.
+	SizeMultipliers map[models.PizzaSize]int // SizeMultipliers in percent of the base price.
+	ToppingPrices   map[string]models.Money  // ToppingPrices per extra topping and pizza.
+	DeliveryFees    map[string]models.Money  // DeliveryFees per planet.
+	TaxRates        map[string]int           // TaxRates in basis points per planet.
+}
+
+// Discounter grants discounts on a priced order.
+// receipt holds the priced lines and the subtotal; code is the promo code given at checkout.
+type Discounter interface {
+	Discounts(order models.Order, receipt models.Receipt, code string, now time.Time) []models.Discount
+}
+
+// Engine prices orders.
+type Engine struct {
+	prices      PriceList
+	discounters []Discounter
+	bestOnly    bool
+	now         func() time.Time
+}
+
+// Option configures an Engine.
+type Option func(*Engine)
+
+// WithDiscounter adds a source of discounts.
+func WithDiscounter(d Discounter) Option {
+	return func(e *Engine) {
+		e.discounters = append(e.discounters, d)
+	}
+}
+
+// WithPromoCodes adds fixed promo codes.
+func WithPromoCodes(promos ...Promo) Option {
+	return WithDiscounter(newPromoCodes(promos))
+}
+
+// WithBestOnly keeps only the largest discount granted by all discounters together,
+// instead of applying every discount in turn.
+func WithBestOnly() Option {
+	return func(e *Engine) {
+		e.bestOnly = true
+	}
+}
+
+// WithClock sets the function used to read the current time.
+func WithClock(now func() time.Time) Option {
+	return func(e *Engine) {
+		e.now = now
+	}
+}
+
+// NewService creates a pricing engine for the given price list.
+func NewService(prices PriceList, opts ...Option) *Engine {
+	e := &Engine{prices: prices, now: time.Now}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Default returns an engine with the default price list and promo codes.
+func Default() *Engine {
+	return NewService(DefaultPriceList(), WithPromoCodes(DefaultPromoCodes...))
+}
+
+// Quote prices the order and returns an itemized receipt.
+// A non-empty promoCode must grant at least one discount, otherwise ErrPromoCodeNotApplicable is returned;
+// with WithBestOnly the code may grant a discount that is then beaten by a larger one.
+func (e *Engine) Quote(order models.Order, promoCode string) (models.Receipt, error) {
+	receipt := models.Receipt{PromoCode: promoCode, IssuedAt: e.now()}
+
+	for i, item := range order.Items {
+		lines, err := e.priceItem(i, item)
+		if err != nil {
+			return models.Receipt{}, fmt.Errorf("price order #%d: %w", order.OrderID, err)
+		}
+		for _, line := range lines {
+			receipt.Lines = append(receipt.Lines, line)
+			receipt.Subtotal += line.Amount
+		}
+	}
+
+	var discounts []models.Discount
+	codeUsed := false
+	for _, d := range e.discounters {
+		for _, discount := range d.Discounts(order, receipt, promoCode, receipt.IssuedAt) {
+			if discount.Amount <= 0 {
+				continue
+			}
+			discounts = append(discounts, discount)
+			codeUsed = codeUsed || discount.Code == promoCode
+		}
+	}
+	// A valid code that loses to a larger discount still counts as used
+	if e.bestOnly && len(discounts) > 0 {
+		discounts = []models.Discount{slices.MaxFunc(discounts, func(a, b models.Discount) int {
+			return cmp.Compare(a.Amount, b.Amount)
+		})}
+	}
+
+	discounted := receipt.Subtotal
+	for _, discount := range discounts {
+		discount.Amount = min(discount.Amount, discounted)
+		if discount.Amount <= 0 {
+			continue
+		}
+		discounted -= discount.Amount
+		receipt.Discounts = append(receipt.Discounts, discount)
+	}
+	if promoCode != "" && !codeUsed {
+		return models.Receipt{}, fmt.Errorf("price order #%d: %w: %q", order.OrderID, ErrPromoCodeNotApplicable, promoCode)
+	}
+
+	fee, ok := e.prices.DeliveryFees[order.Planet]
+	if !ok {
+		return models.Receipt{}, fmt.Errorf("price order #%d: %w %q", order.OrderID, ErrNoDelivery, order.Planet)
+	}
+	receipt.DeliveryFee = fee
+	receipt.Tax = Percent(discounted+fee, e.prices.TaxRates[order.Planet])
+	receipt.Total = discounted + fee + receipt.Tax
+
+	return receipt, nil
+}
+
+// priceItem returns the receipt lines of a line item: the pizza and its extra toppings.
+func (e *Engine) priceItem(index int, item models.LineItem) ([]models.ReceiptLine, error) {
+	base, ok := e.prices.BasePrices[item.PizzaType]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownPizzaType, item.PizzaType)
+	}
+	multiplier, ok := e.prices.SizeMultipliers[item.Size]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownSize, item.Size)
+	}
+
+	unit := Percent(base, multiplier*100)
+	lines := []models.ReceiptLine{{
+		Item:        index,
+		Description: fmt.Sprintf("%s %s", item.Size, item.PizzaType),
+		Quantity:    item.Quantity,
+		UnitPrice:   unit,
+		Amount:      unit * models.Money(item.Quantity),
+	}}
+
+	for _, topping := range item.Toppings {
+		price, ok := e.prices.ToppingPrices[topping]
+		if !ok {
+			return nil, fmt.Errorf("%w %q", ErrUnknownTopping, topping)
+		}
+		lines = append(lines, models.ReceiptLine{
+			Item:        index,
+			Description: fmt.Sprintf("  + %s", topping),
+			Quantity:    item.Quantity,
+			UnitPrice:   price,
+			Amount:      price * models.Money(item.Quantity),
+		})
+	}
+	return lines, nil
+}
+
+// Percent returns amount times basisPoints / 10000, rounded half up to the cent.
+func Percent(amount models.Money, basisPoints int) models.Money {
+	product := int64(amount) * int64(basisPoints)
+	if product < 0 {
+		return -models.Money((-product + 5000) / 10000)
+	}
+	return models.Money((product + 5000) / 10000)
+}
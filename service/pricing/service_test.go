@@ -0,0 +1,177 @@
+package pricing
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+)
+
+var now = time.Date(2026, 6, 6, 12, 0, 0, 0, time.UTC)
+
+// discounterFunc adapts a function to the Discounter interface.
+type discounterFunc func(order models.Order, receipt models.Receipt, code string, now time.Time) []models.Discount
+
+func (f discounterFunc) Discounts(order models.Order, receipt models.Receipt, code string, now time.Time) []models.Discount {
+	return f(order, receipt, code, now)
+}
+
+// bothDefaultCodes grants BIGBANG10 and ORBIT5 together, whatever code was given.
+var bothDefaultCodes = discounterFunc(func(order models.Order, receipt models.Receipt, code string, now time.Time) []models.Discount {
+	codes := newPromoCodes(DefaultPromoCodes)
+	return append(codes.Discounts(order, receipt, "BIGBANG10", now), codes.Discounts(order, receipt, "ORBIT5", now)...)
+})
+
+func TestPercent(t *testing.T) {
+	tests := []struct {
+		amount      models.Money
+		basisPoints int
+		want        models.Money
+	}{
+		{amount: 999, basisPoints: 1000, want: 100}, // 99.9
+		{amount: 5, basisPoints: 5000, want: 3},     // 2.5 rounds up
+		{amount: 1, basisPoints: 5000, want: 1},     // 0.5 rounds up
+		{amount: 1, basisPoints: 4999, want: 0},     // 0.4999 rounds down
+		{amount: 1497, basisPoints: 800, want: 120}, // 119.76
+		{amount: 1375, basisPoints: 800, want: 110}, // 110 exactly
+		{amount: 999, basisPoints: 0, want: 0},
+		{amount: 999, basisPoints: 10000, want: 999},
+		{amount: -5, basisPoints: 5000, want: -3}, // half away from zero
+	}
+	for _, tt := range tests {
+		if got := Percent(tt.amount, tt.basisPoints); got != tt.want {
+			t.Errorf("Percent(%d, %d) = %d, want %d", tt.amount, tt.basisPoints, got, tt.want)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	medium := func(pizzaType string, quantity int, toppings ...string) models.LineItem {
+		return models.LineItem{PizzaType: pizzaType, Size: models.SizeMedium, Quantity: quantity, Toppings: toppings}
+	}
+	tests := []struct {
+		name      string
+		opts      []Option
+		planet    string
+		items     []models.LineItem
+		promoCode string
+		want      models.Receipt // want holds the expected amounts, Lines are not compared
+		wantErr   error
+	}{
+		{
+			name:   "medium pizza on Mars",
+			planet: "Mars",
+			items:  []models.LineItem{medium("Galactic Cheese", 1)},
+			want:   models.Receipt{Subtotal: 999, DeliveryFee: 499, Tax: 120, Total: 1618}, // 8% of 14.98
+		},
+		{
+			name:   "size multipliers",
+			planet: "Pluto",
+			items: []models.LineItem{
+				{PizzaType: "Galactic Cheese", Size: models.SizeSmall, Quantity: 1},    // 7.4925
+				{PizzaType: "Galactic Cheese", Size: models.SizeLarge, Quantity: 1},    // 12.987
+				{PizzaType: "Galactic Cheese", Size: models.SizeGalactic, Quantity: 1}, // 19.98
+			},
+			want: models.Receipt{Subtotal: 749 + 1299 + 1998, DeliveryFee: 2499, Tax: 0, Total: 749 + 1299 + 1998 + 2499},
+		},
+		{
+			name:   "toppings per pizza",
+			planet: "Venus",
+			items:  []models.LineItem{medium("Galactic Cheese", 2, "Lunar Ham", "Solar Basil")},
+			want:   models.Receipt{Subtotal: 2*999 + 2*180 + 2*80, DeliveryFee: 399, Tax: 219, Total: 2518 + 399 + 219}, // 7.5% of 29.17
+		},
+		{
+			name:      "tax after the discount",
+			opts:      []Option{WithPromoCodes(DefaultPromoCodes...)},
+			planet:    "Mars",
+			items:     []models.LineItem{medium("Galactic Cheese", 1)},
+			promoCode: "BIGBANG10",
+			want: models.Receipt{Subtotal: 999, Discounts: []models.Discount{{Code: "BIGBANG10", Amount: 100}},
+				DeliveryFee: 499, Tax: 112, Total: 899 + 499 + 112}, // 8% of 13.98
+		},
+		{
+			name:      "amount off capped at the subtotal",
+			opts:      []Option{WithPromoCodes(Promo{Code: "FREE", AmountOff: 5000})},
+			planet:    "Pluto",
+			items:     []models.LineItem{medium("Galactic Cheese", 1)},
+			promoCode: "FREE",
+			want:      models.Receipt{Subtotal: 999, Discounts: []models.Discount{{Code: "FREE", Amount: 999}}, DeliveryFee: 2499, Total: 2499},
+		},
+		{
+			name:   "stacking both codes",
+			opts:   []Option{WithDiscounter(bothDefaultCodes)},
+			planet: "Pluto",
+			items:  []models.LineItem{medium("Galactic Cheese", 1)},
+			want: models.Receipt{Subtotal: 999, Discounts: []models.Discount{{Code: "BIGBANG10", Amount: 100}, {Code: "ORBIT5", Amount: 500}},
+				DeliveryFee: 2499, Total: 399 + 2499},
+		},
+		{
+			name:   "best only keeps ORBIT5 on a small order",
+			opts:   []Option{WithDiscounter(bothDefaultCodes), WithBestOnly()},
+			planet: "Pluto",
+			items:  []models.LineItem{medium("Galactic Cheese", 1)},
+			want:   models.Receipt{Subtotal: 999, Discounts: []models.Discount{{Code: "ORBIT5", Amount: 500}}, DeliveryFee: 2499, Total: 499 + 2499},
+		},
+		{
+			name:   "best only keeps BIGBANG10 on a big order",
+			opts:   []Option{WithDiscounter(bothDefaultCodes), WithBestOnly()},
+			planet: "Pluto",
+			items:  []models.LineItem{medium("Antimatter Pizza", 3)},
+			want:   models.Receipt{Subtotal: 7497, Discounts: []models.Discount{{Code: "BIGBANG10", Amount: 750}}, DeliveryFee: 2499, Total: 6747 + 2499},
+		},
+		{
+			name:      "unknown promo code",
+			opts:      []Option{WithPromoCodes(DefaultPromoCodes...)},
+			planet:    "Mars",
+			items:     []models.LineItem{medium("Galactic Cheese", 1)},
+			promoCode: "NOPE",
+			wantErr:   ErrPromoCodeNotApplicable,
+		},
+		{
+			name: "expired promo code",
+			opts: []Option{WithDiscounter(discounterFunc(func(order models.Order, receipt models.Receipt, code string, at time.Time) []models.Discount {
+				if code != "SPRING" || !at.Before(now.AddDate(0, -1, 0)) {
+					return nil
+				}
+				return []models.Discount{{Code: "SPRING", Amount: 100}}
+			}))},
+			planet:    "Mars",
+			items:     []models.LineItem{medium("Galactic Cheese", 1)},
+			promoCode: "SPRING",
+			wantErr:   ErrPromoCodeNotApplicable,
+		},
+		{name: "unknown pizza type", planet: "Mars", items: []models.LineItem{medium("Pineapple", 1)}, wantErr: ErrUnknownPizzaType},
+		{name: "unknown size", planet: "Mars", items: []models.LineItem{{PizzaType: "Galactic Cheese", Size: "huge", Quantity: 1}}, wantErr: ErrUnknownSize},
+		{name: "unknown topping", planet: "Mars", items: []models.LineItem{medium("Galactic Cheese", 1, "Gold Leaf")}, wantErr: ErrUnknownTopping},
+		{name: "no delivery", planet: "Earth", items: []models.LineItem{medium("Galactic Cheese", 1)}, wantErr: ErrNoDelivery},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := NewService(DefaultPriceList(), append(tt.opts, WithClock(func() time.Time { return now }))...)
+			got, err := engine.Quote(models.Order{OrderID: 1, Planet: tt.planet, Items: tt.items}, tt.promoCode)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Quote: got error %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if got.Subtotal != tt.want.Subtotal || got.DeliveryFee != tt.want.DeliveryFee || got.Tax != tt.want.Tax || got.Total != tt.want.Total {
+				t.Errorf("subtotal %d, delivery %d, tax %d, total %d; want %d, %d, %d, %d",
+					got.Subtotal, got.DeliveryFee, got.Tax, got.Total, tt.want.Subtotal, tt.want.DeliveryFee, tt.want.Tax, tt.want.Total)
+			}
+			if len(got.Discounts) != len(tt.want.Discounts) {
+				t.Fatalf("discounts %v, want %v", got.Discounts, tt.want.Discounts)
+			}
+			for i, discount := range got.Discounts {
+				if discount.Code != tt.want.Discounts[i].Code || discount.Amount != tt.want.Discounts[i].Amount {
+					t.Errorf("discount %d = %s %d, want %s %d", i, discount.Code, discount.Amount, tt.want.Discounts[i].Code, tt.want.Discounts[i].Amount)
+				}
+			}
+			if !got.IssuedAt.Equal(now) {
+				t.Errorf("IssuedAt = %s, want %s", got.IssuedAt, now)
+			}
+		})
+	}
+}
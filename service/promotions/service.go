@@ -0,0 +1,324 @@
+// Package promotions is a declarative discount rules engine. Rules are loaded from JSON
+// or YAML, evaluated against a priced order and produce the applied discounts with their reasons.
+//
+// Conflicts are resolved by the rule set mode: with ModeBestOnly only the largest
+// discount applies; with ModeStack all stackable rules add up, and a non-stackable
+// rule applies alone if it beats that sum. Engine.PricingOption extends best-only
+// to the other discounters of the pricing engine, such as its promo codes.
+package promotions
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+	"github.com/gleb-korostelev/CosmicPizza.git/service/pricing"
+)
+
+// Rule types
+const (
+	TypePercentOff = "percent_off" // Percent off the matching lines, or the subtotal without pizza type conditions.
+	TypeAmountOff  = "amount_off"  // Fixed amount off the subtotal.
+	TypeBuyXGetY   = "buy_x_get_y" // For every Buy+Get matching pizzas, the Get cheapest are free.
+)
+
+// Conflict resolution modes
+const (
+	ModeStack    = "stack"
+	ModeBestOnly = "best_only"
+)
+
+// ErrInvalidRule is returned when a rule set fails validation.
+var ErrInvalidRule = errors.New("invalid promotion rule")
+
+// Conditions restrict when a rule applies. Empty fields match everything.
+type Conditions struct {
+	Planets     []string     `json:"planets,omitempty"`
+	PizzaTypes  []string     `json:"pizzaTypes,omitempty"`
+	Code        string       `json:"code,omitempty"`        // Code is the promo code the customer must give.
+	ValidFrom   *time.Time   `json:"validFrom,omitempty"`   // ValidFrom is the first moment the rule applies.
+	ValidUntil  *time.Time   `json:"validUntil,omitempty"`  // ValidUntil is the moment the rule stops applying.
+	MinSubtotal models.Money `json:"minSubtotal,omitempty"` // MinSubtotal in cents the order must reach.
+}
+
+// Rule is a single promotion.
+type Rule struct {
+	ID          string       `json:"id"`
+	Description string       `json:"description,omitempty"`
+	Type        string       `json:"type"`
+	Percent     int          `json:"percent,omitempty"` // Percent for percent_off rules.
+	Amount      models.Money `json:"amount,omitempty"`  // Amount in cents for amount_off rules.
+	Buy         int          `json:"buy,omitempty"`     // Buy for buy_x_get_y rules.
+	Get         int          `json:"get,omitempty"`     // Get for buy_x_get_y rules.
+	Stackable   bool         `json:"stackable,omitempty"`
+	Conditions  Conditions   `json:"conditions"`
+}
+
+// RuleSet is the JSON or YAML document loaded by the engine. YAML documents use the JSON field names.
+type RuleSet struct {
+	Mode  string `json:"mode"`
+	Rules []Rule `json:"rules"`
+}
+
+// Engine evaluates a rule set. It implements pricing.Discounter.
+type Engine struct {
+	mode  string
+	rules []Rule
+}
+
+// NewService creates an engine for a validated rule set.
+func NewService(set RuleSet) (*Engine, error) {
+	if set.Mode == "" {
+		set.Mode = ModeStack
+	}
+	if set.Mode != ModeStack && set.Mode != ModeBestOnly {
+		return nil, fmt.Errorf("%w: unknown mode %q", ErrInvalidRule, set.Mode)
+	}
+
+	ids := make(map[string]bool, len(set.Rules))
+	for _, rule := range set.Rules {
+		if err := rule.validate(); err != nil {
+			return nil, err
+		}
+		if ids[rule.ID] {
+			return nil, fmt.Errorf("%w: duplicate id %q", ErrInvalidRule, rule.ID)
+		}
+		ids[rule.ID] = true
+	}
+
+	return &Engine{mode: set.Mode, rules: slices.Clone(set.Rules)}, nil
+}
+
+// Load reads a JSON rule set from r.
+func Load(r io.Reader) (*Engine, error) {
+	var set RuleSet
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&set); err != nil {
+		return nil, fmt.Errorf("decode promotion rules: %w", err)
+	}
+	return NewService(set)
+}
+
+// LoadYAML reads a YAML rule set from r. The document is converted to JSON and decoded
+// like Load, so unknown fields are rejected the same way.
+func LoadYAML(r io.Reader) (*Engine, error) {
+	var doc any
+	if err := yaml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decode promotion rules: %w", err)
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("decode promotion rules: %w", err)
+	}
+	return Load(bytes.NewReader(data))
+}
+
+// LoadFile reads a rule set from the file at path: YAML for .yaml and .yml files, JSON otherwise.
+func LoadFile(path string) (*Engine, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return LoadYAML(f)
+	}
+	return Load(f)
+}
+
+// Discounts evaluates every rule against the priced order and resolves conflicts.
+func (e *Engine) Discounts(order models.Order, receipt models.Receipt, code string, now time.Time) []models.Discount {
+	var stackable, exclusive []models.Discount
+	for _, rule := range e.rules {
+		discount, ok := rule.evaluate(order, receipt, code, now)
+		if !ok {
+			continue
+		}
+		if rule.Stackable && e.mode == ModeStack {
+			stackable = append(stackable, discount)
+		} else {
+			exclusive = append(exclusive, discount)
+		}
+	}
+
+	var stacked models.Money
+	for _, discount := range stackable {
+		stacked += discount.Amount
+	}
+	best := slices.MaxFunc(append([]models.Discount{{}}, exclusive...), func(a, b models.Discount) int {
+		return cmp.Compare(a.Amount, b.Amount)
+	})
+	if best.Amount > 0 && best.Amount >= stacked {
+		return []models.Discount{best}
+	}
+	return stackable
+}
+
+// PricingOption adds the engine to a pricing engine. In ModeBestOnly the pricing engine then
+// keeps only the largest discount across all its discounters, so a promo code does not
+// add up with a rule.
+func (e *Engine) PricingOption() pricing.Option {
+	return func(p *pricing.Engine) {
+		pricing.WithDiscounter(e)(p)
+		if e.mode == ModeBestOnly {
+			pricing.WithBestOnly()(p)
+		}
+	}
+}
+
+// validate checks that the rule has what its type needs.
+func (r Rule) validate() error {
+	if r.ID == "" {
+		return fmt.Errorf("%w: missing id", ErrInvalidRule)
+	}
+
+	switch r.Type {
+	case TypePercentOff:
+		if r.Percent <= 0 || r.Percent > 100 {
+			return fmt.Errorf("%w %q: percent must be in 1..100", ErrInvalidRule, r.ID)
+		}
+	case TypeAmountOff:
+		if r.Amount <= 0 {
+			return fmt.Errorf("%w %q: amount must be positive", ErrInvalidRule, r.ID)
+		}
+	case TypeBuyXGetY:
+		if r.Buy <= 0 || r.Get <= 0 {
+			return fmt.Errorf("%w %q: buy and get must be positive", ErrInvalidRule, r.ID)
+		}
+	default:
+		return fmt.Errorf("%w %q: unknown type %q", ErrInvalidRule, r.ID, r.Type)
+	}
+
+	if c := r.Conditions; c.ValidFrom != nil && c.ValidUntil != nil && !c.ValidUntil.After(*c.ValidFrom) {
+		return fmt.Errorf("%w %q: validUntil must be after validFrom", ErrInvalidRule, r.ID)
+	}
+	return nil
+}
+
+// evaluate returns the discount the rule grants, if any.
+func (r Rule) evaluate(order models.Order, receipt models.Receipt, code string, now time.Time) (models.Discount, bool) {
+	if !r.Conditions.matchOrder(order, receipt, code, now) {
+		return models.Discount{}, false
+	}
+
+	var amount models.Money
+	switch r.Type {
+	case TypePercentOff:
+		amount = pricing.Percent(r.matchingAmount(order, receipt), r.Percent*100)
+	case TypeAmountOff:
+		amount = r.Amount
+	case TypeBuyXGetY:
+		amount = r.freeAmount(order, receipt)
+	}
+	if amount <= 0 {
+		return models.Discount{}, false
+	}
+
+	discount := models.Discount{Code: r.ID, Reason: r.reason(), Amount: amount}
+	if r.Conditions.Code != "" {
+		discount.Code = r.Conditions.Code
+	}
+	return discount, true
+}
+
+// reason describes why the discount was granted.
+func (r Rule) reason() string {
+	if r.Description != "" {
+		return r.Description
+	}
+	switch r.Type {
+	case TypePercentOff:
+		return fmt.Sprintf("%d%% off (%s)", r.Percent, r.ID)
+	case TypeAmountOff:
+		return fmt.Sprintf("%s off (%s)", r.Amount, r.ID)
+	default:
+		return fmt.Sprintf("buy %d get %d free (%s)", r.Buy, r.Get, r.ID)
+	}
+}
+
+// matchingAmount sums the receipt lines of the items matching the pizza type condition.
+func (r Rule) matchingAmount(order models.Order, receipt models.Receipt) models.Money {
+	if len(r.Conditions.PizzaTypes) == 0 {
+		return receipt.Subtotal
+	}
+
+	var amount models.Money
+	for _, line := range receipt.Lines {
+		if r.Conditions.matchItem(order, line.Item) {
+			amount += line.Amount
+		}
+	}
+	return amount
+}
+
+// freeAmount returns the price of the free pizzas: for every Buy+Get matching
+// pizzas the Get cheapest ones, toppings included.
+func (r Rule) freeAmount(order models.Order, receipt models.Receipt) models.Money {
+	unitPrices := make(map[int]models.Money)
+	for _, line := range receipt.Lines {
+		if r.Conditions.matchItem(order, line.Item) {
+			unitPrices[line.Item] += line.UnitPrice
+		}
+	}
+
+	var units []models.Money
+	for item, price := range unitPrices {
+		for range order.Items[item].Quantity {
+			units = append(units, price)
+		}
+	}
+	slices.Sort(units)
+
+	var amount models.Money
+	for _, price := range units[:len(units)/(r.Buy+r.Get)*r.Get] {
+		amount += price
+	}
+	return amount
+}
+
+// matchOrder checks the order-level conditions.
+func (c Conditions) matchOrder(order models.Order, receipt models.Receipt, code string, now time.Time) bool {
+	if c.Code != "" && c.Code != code {
+		return false
+	}
+	if c.ValidFrom != nil && now.Before(*c.ValidFrom) {
+		return false
+	}
+	if c.ValidUntil != nil && !now.Before(*c.ValidUntil) {
+		return false
+	}
+	if len(c.Planets) > 0 && !slices.Contains(c.Planets, order.Planet) {
+		return false
+	}
+	if receipt.Subtotal < c.MinSubtotal {
+		return false
+	}
+	if len(c.PizzaTypes) > 0 {
+		return slices.ContainsFunc(order.Items, func(item models.LineItem) bool {
+			return slices.Contains(c.PizzaTypes, item.PizzaType)
+		})
+	}
+	return true
+}
+
+// matchItem checks the pizza type condition for the line item at index.
+func (c Conditions) matchItem(order models.Order, index int) bool {
+	if index < 0 || index >= len(order.Items) {
+		return false
+	}
+	return len(c.PizzaTypes) == 0 || slices.Contains(c.PizzaTypes, order.Items[index].PizzaType)
+}
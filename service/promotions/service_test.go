@@ -0,0 +1,240 @@
+package promotions_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+	"github.com/gleb-korostelev/CosmicPizza.git/service/pricing"
+	"github.com/gleb-korostelev/CosmicPizza.git/service/promotions"
+)
+
+var now = time.Date(2026, 6, 6, 12, 0, 0, 0, time.UTC)
+
+func TestDiscounts(t *testing.T) {
+	tests := []struct {
+		name      string
+		rules     string
+		order     models.Order
+		promoCode string
+		now       time.Time
+		want      models.Money
+		wantErr   error
+	}{
+		{
+			name:  "percent off pizza type on planet",
+			rules: `{"rules":[{"id":"saturn","type":"percent_off","percent":10,"conditions":{"planets":["Saturn"],"pizzaTypes":["Nebula Deluxe"]}}]}`,
+			order: order("Saturn", models.LineItem{PizzaType: "Nebula Deluxe", Size: models.SizeMedium, Quantity: 1},
+				models.LineItem{PizzaType: "Galactic Cheese", Size: models.SizeMedium, Quantity: 1}),
+			want: 160, // 10% of 15.99
+		},
+		{
+			name:  "percent off on another planet",
+			rules: `{"rules":[{"id":"saturn","type":"percent_off","percent":10,"conditions":{"planets":["Saturn"],"pizzaTypes":["Nebula Deluxe"]}}]}`,
+			order: order("Mars", models.LineItem{PizzaType: "Nebula Deluxe", Size: models.SizeMedium, Quantity: 1}),
+			want:  0,
+		},
+		{
+			name:  "buy two get one free",
+			rules: `{"rules":[{"id":"b2g1","type":"buy_x_get_y","buy":2,"get":1,"conditions":{}}]}`,
+			order: order("Mars", models.LineItem{PizzaType: "Galactic Cheese", Size: models.SizeMedium, Quantity: 2},
+				models.LineItem{PizzaType: "Antimatter Pizza", Size: models.SizeMedium, Quantity: 1}),
+			want: 999, // the cheapest of three
+		},
+		{
+			name:  "buy two get one free with two pizzas",
+			rules: `{"rules":[{"id":"b2g1","type":"buy_x_get_y","buy":2,"get":1,"conditions":{}}]}`,
+			order: order("Mars", models.LineItem{PizzaType: "Galactic Cheese", Size: models.SizeMedium, Quantity: 2}),
+			want:  0,
+		},
+		{
+			name:      "time-limited code inside its window",
+			rules:     `{"rules":[{"id":"launch","type":"amount_off","amount":500,"conditions":{"code":"LAUNCH","validFrom":"2026-06-01T00:00:00Z","validUntil":"2026-06-08T00:00:00Z"}}]}`,
+			order:     order("Mars", models.LineItem{PizzaType: "Galactic Cheese", Size: models.SizeMedium, Quantity: 1}),
+			promoCode: "LAUNCH",
+			want:      500,
+		},
+		{
+			name:      "time-limited code after expiry",
+			rules:     `{"rules":[{"id":"launch","type":"amount_off","amount":500,"conditions":{"code":"LAUNCH","validFrom":"2026-06-01T00:00:00Z","validUntil":"2026-06-08T00:00:00Z"}}]}`,
+			order:     order("Mars", models.LineItem{PizzaType: "Galactic Cheese", Size: models.SizeMedium, Quantity: 1}),
+			promoCode: "LAUNCH",
+			now:       now.AddDate(0, 1, 0),
+			wantErr:   pricing.ErrPromoCodeNotApplicable,
+		},
+		{
+			name:  "minimum subtotal not reached",
+			rules: `{"rules":[{"id":"big","type":"amount_off","amount":500,"conditions":{"minSubtotal":2000}}]}`,
+			order: order("Mars", models.LineItem{PizzaType: "Galactic Cheese", Size: models.SizeMedium, Quantity: 1}),
+			want:  0,
+		},
+		{
+			name: "stacking adds up stackable rules",
+			rules: `{"mode":"stack","rules":[
+				{"id":"a","type":"amount_off","amount":100,"stackable":true,"conditions":{}},
+				{"id":"b","type":"amount_off","amount":200,"stackable":true,"conditions":{}}]}`,
+			order: order("Mars", models.LineItem{PizzaType: "Galactic Cheese", Size: models.SizeMedium, Quantity: 1}),
+			want:  300,
+		},
+		{
+			name: "best only keeps the largest discount",
+			rules: `{"mode":"best_only","rules":[
+				{"id":"a","type":"amount_off","amount":100,"stackable":true,"conditions":{}},
+				{"id":"b","type":"amount_off","amount":200,"stackable":true,"conditions":{}}]}`,
+			order: order("Mars", models.LineItem{PizzaType: "Galactic Cheese", Size: models.SizeMedium, Quantity: 1}),
+			want:  200,
+		},
+		{
+			name: "exclusive rule beats a smaller stack",
+			rules: `{"mode":"stack","rules":[
+				{"id":"a","type":"amount_off","amount":100,"stackable":true,"conditions":{}},
+				{"id":"b","type":"percent_off","percent":50,"conditions":{}}]}`,
+			order: order("Mars", models.LineItem{PizzaType: "Galactic Cheese", Size: models.SizeMedium, Quantity: 1}),
+			want:  500, // 50% of 9.99
+		},
+		{
+			name:      "stacking adds a promo code to the rules",
+			rules:     `{"mode":"stack","rules":[{"id":"a","type":"amount_off","amount":200,"stackable":true,"conditions":{}}]}`,
+			order:     order("Mars", models.LineItem{PizzaType: "Galactic Cheese", Size: models.SizeMedium, Quantity: 1}),
+			promoCode: "BIGBANG10",
+			want:      300, // 2.00 plus 10% of 9.99
+		},
+		{
+			name:      "best only beats a smaller promo code",
+			rules:     `{"mode":"best_only","rules":[{"id":"a","type":"amount_off","amount":200,"stackable":true,"conditions":{}}]}`,
+			order:     order("Mars", models.LineItem{PizzaType: "Galactic Cheese", Size: models.SizeMedium, Quantity: 1}),
+			promoCode: "BIGBANG10",
+			want:      200,
+		},
+		{
+			name:      "best only keeps a larger promo code",
+			rules:     `{"mode":"best_only","rules":[{"id":"a","type":"amount_off","amount":200,"stackable":true,"conditions":{}}]}`,
+			order:     order("Mars", models.LineItem{PizzaType: "Galactic Cheese", Size: models.SizeMedium, Quantity: 1}),
+			promoCode: "ORBIT5",
+			want:      500,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := promotions.Load(strings.NewReader(tt.rules))
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			at := tt.now
+			if at.IsZero() {
+				at = now
+			}
+			engine := pricing.NewService(pricing.DefaultPriceList(), pricing.WithPromoCodes(pricing.DefaultPromoCodes...),
+				rules.PricingOption(), pricing.WithClock(func() time.Time { return at }))
+
+			receipt, err := engine.Quote(tt.order, tt.promoCode)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Quote: got error %v, want %v", err, tt.wantErr)
+			}
+			var got models.Money
+			for _, discount := range receipt.Discounts {
+				got += discount.Amount
+			}
+			if got != tt.want {
+				t.Errorf("got discount %s, want %s (%v)", got, tt.want, receipt.Discounts)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+	}{
+		{name: "unknown mode", rules: `{"mode":"cheapest","rules":[]}`},
+		{name: "missing id", rules: `{"rules":[{"type":"amount_off","amount":100,"conditions":{}}]}`},
+		{name: "duplicate id", rules: `{"rules":[
+			{"id":"a","type":"amount_off","amount":100,"conditions":{}},
+			{"id":"a","type":"amount_off","amount":200,"conditions":{}}]}`},
+		{name: "percent over 100", rules: `{"rules":[{"id":"a","type":"percent_off","percent":150,"conditions":{}}]}`},
+		{name: "no amount", rules: `{"rules":[{"id":"a","type":"amount_off","conditions":{}}]}`},
+		{name: "no get", rules: `{"rules":[{"id":"a","type":"buy_x_get_y","buy":2,"conditions":{}}]}`},
+		{name: "unknown type", rules: `{"rules":[{"id":"a","type":"free_pizza","conditions":{}}]}`},
+		{name: "empty window", rules: `{"rules":[{"id":"a","type":"amount_off","amount":100,"conditions":{
+			"validFrom":"2026-06-08T00:00:00Z","validUntil":"2026-06-01T00:00:00Z"}}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := promotions.Load(strings.NewReader(tt.rules)); !errors.Is(err, promotions.ErrInvalidRule) {
+				t.Errorf("Load: got %v, want ErrInvalidRule", err)
+			}
+		})
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	// Both files hold the same rules, so they grant the same discounts
+	orders := []struct {
+		order     models.Order
+		promoCode string
+		want      models.Money
+	}{
+		{
+			order: order("Saturn", models.LineItem{PizzaType: "Nebula Deluxe", Size: models.SizeMedium, Quantity: 1},
+				models.LineItem{PizzaType: "Galactic Cheese", Size: models.SizeMedium, Quantity: 1}),
+			promoCode: "LAUNCH",
+			want:      660, // 10% of 15.99 stacked with 5.00
+		},
+		{
+			order: order("Mars", models.LineItem{PizzaType: "Galactic Cheese", Size: models.SizeMedium, Quantity: 3}),
+			want:  999, // the third pizza
+		},
+	}
+	for _, path := range []string{"../../config/promotions.json", "testdata/promotions.yaml"} {
+		rules, err := promotions.LoadFile(path)
+		if err != nil {
+			t.Fatalf("LoadFile(%s): %v", path, err)
+		}
+		engine := pricing.NewService(pricing.DefaultPriceList(), rules.PricingOption(), pricing.WithClock(func() time.Time { return now }))
+		for _, o := range orders {
+			receipt, err := engine.Quote(o.order, o.promoCode)
+			if err != nil {
+				t.Fatalf("%s: Quote: %v", path, err)
+			}
+			var got models.Money
+			for _, discount := range receipt.Discounts {
+				got += discount.Amount
+			}
+			if got != o.want {
+				t.Errorf("%s: got discount %s on %s, want %s (%v)", path, got, o.order.Planet, o.want, receipt.Discounts)
+			}
+		}
+	}
+}
+
+func TestLoadYAMLIsStrict(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		wantErr error
+	}{
+		{name: "unknown field", rules: "rules:\n  - id: a\n    type: amount_off\n    amount: 100\n    discount: 100\n"},
+		{name: "unknown condition", rules: "rules:\n  - id: a\n    type: amount_off\n    amount: 100\n    conditions:\n      planet: Mars\n"},
+		{name: "wrong type", rules: "rules:\n  - id: a\n    type: amount_off\n    amount: lots\n"},
+		{name: "not YAML", rules: "rules: [\n"},
+		{name: "invalid rule", rules: "rules:\n  - id: a\n    type: percent_off\n    percent: 150\n", wantErr: promotions.ErrInvalidRule},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := promotions.LoadYAML(strings.NewReader(tt.rules))
+			if err == nil {
+				t.Fatal("LoadYAML accepted the rules")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("LoadYAML: got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func order(planet string, items ...models.LineItem) models.Order {
+	return models.Order{OrderID: 1, Planet: planet, PizzaType: items[0].PizzaType, Items: items}
+}
@@ -0,0 +1,113 @@
+// Package reaper expires orders that waited too long for the kitchen. A background loop
+// calls an expire function at a fixed interval, logs every expired order and keeps counters
+// of the expirations. The reaper implements closer.Closer so it stops with the application.
+package reaper
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+	"github.com/gleb-korostelev/CosmicPizza.git/tools/logger"
+)
+
+// ErrInvalidInterval is returned by New for an interval that is not positive.
+var ErrInvalidInterval = errors.New("reaper interval must be positive")
+
+// ExpireFunc expires the orders due by now and returns them.
+type ExpireFunc func(now time.Time) ([]models.Order, error)
+
+// Stats counts the work of a reaper.
+type Stats struct {
+	Runs        int                        // Runs is the number of expiry runs.
+	Expired     int                        // Expired is the number of expired orders.
+	ByPlanet    map[string]int             // ByPlanet counts expired orders per planet.
+	ByStatus    map[models.OrderStatus]int // ByStatus counts expired orders per status they were left in.
+	Errors      int                        // Errors is the number of failed runs.
+	LastExpired time.Time                  // LastExpired is when the latest order expired, zero if none did.
+}
+
+// Reaper runs an ExpireFunc periodically until it is closed.
+type Reaper struct {
+	expire ExpireFunc
+
+	mu    sync.Mutex
+	stats Stats
+
+	done chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+// New creates a reaper calling expire every interval and starts it right away.
+// It returns ErrInvalidInterval if interval is not positive.
+func New(expire ExpireFunc, interval time.Duration) (*Reaper, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("start reaper every %s: %w", interval, ErrInvalidInterval)
+	}
+	r := &Reaper{
+		expire: expire,
+		stats:  Stats{ByPlanet: make(map[string]int), ByStatus: make(map[models.OrderStatus]int)},
+		done:   make(chan struct{}),
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.done:
+				return
+			case now := <-ticker.C:
+				r.Reap(now)
+			}
+		}
+	}()
+	return r, nil
+}
+
+// Reap runs a single expiry at now and returns the expired orders.
+func (r *Reaper) Reap(now time.Time) []models.Order {
+	expired, err := r.expire(now)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stats.Runs++
+	if err != nil {
+		r.stats.Errors++
+		logger.Errorf("Reaper: %v", err)
+	}
+	for _, order := range expired {
+		r.stats.Expired++
+		r.stats.ByPlanet[order.Planet]++
+		r.stats.ByStatus[order.Status]++
+		r.stats.LastExpired = now
+		logger.Infof("Reaper: order #%d from %s expired at %s (%s)", order.OrderID, order.Planet, order.ExpiresAt.Format(time.TimeOnly), order.Status)
+	}
+	return expired
+}
+
+// Stats returns a copy of the counters.
+func (r *Reaper) Stats() Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := r.stats
+	stats.ByPlanet = maps.Clone(r.stats.ByPlanet)
+	stats.ByStatus = maps.Clone(r.stats.ByStatus)
+	return stats
+}
+
+// Close stops the background loop and waits for a running expiry to finish.
+func (r *Reaper) Close() error {
+	r.once.Do(func() { close(r.done) })
+	r.wg.Wait()
+	return nil
+}
@@ -0,0 +1,108 @@
+package reaper
+
+import (
+	"errors"
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+	cosmicorder "github.com/gleb-korostelev/CosmicPizza.git/service/cosmicOrder"
+)
+
+func TestReapStats(t *testing.T) {
+	list := cosmicorder.NewService(cosmicorder.WithTTL(cosmicorder.TTLPolicy{
+		Default: time.Minute,
+		Planets: map[string]time.Duration{"Pluto": time.Hour},
+	}))
+	placed := time.Now()
+	for id, planet := range []string{"Mars", "Mars", "Venus", "Pluto", "Saturn"} {
+		if err := list.PlaceOrder(models.Order{OrderID: id + 1, Planet: planet, PizzaType: "Galactic Cheese"}); err != nil {
+			t.Fatalf("PlaceOrder: %v", err)
+		}
+	}
+	// The kitchen took order #5 before it expired
+	if err := list.Advance(5, models.StatusPreparing); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+
+	fail := errors.New("store unavailable")
+	failing := false
+	r := &Reaper{
+		expire: func(now time.Time) ([]models.Order, error) {
+			if failing {
+				return nil, fail
+			}
+			return list.Expire(now)
+		},
+		stats: Stats{ByPlanet: make(map[string]int), ByStatus: make(map[models.OrderStatus]int)},
+	}
+
+	steps := []struct {
+		after   time.Duration
+		fail    bool
+		expired int
+	}{
+		{after: 30 * time.Second},
+		{after: 2 * time.Minute, expired: 3},
+		{after: 90 * time.Minute, fail: true},
+		{after: 2 * time.Hour, expired: 1},
+	}
+	for _, step := range steps {
+		failing = step.fail
+		if got := r.Reap(placed.Add(step.after)); len(got) != step.expired {
+			t.Errorf("Reap after %s expired %d orders, want %d", step.after, len(got), step.expired)
+		}
+	}
+
+	stats := r.Stats()
+	if stats.Runs != 4 || stats.Expired != 4 || stats.Errors != 1 {
+		t.Errorf("Runs %d Expired %d Errors %d, want 4, 4 and 1", stats.Runs, stats.Expired, stats.Errors)
+	}
+	if want := map[string]int{"Mars": 2, "Venus": 1, "Pluto": 1}; !maps.Equal(stats.ByPlanet, want) {
+		t.Errorf("ByPlanet = %v, want %v", stats.ByPlanet, want)
+	}
+	if want := map[models.OrderStatus]int{models.StatusCancelled: 4}; !maps.Equal(stats.ByStatus, want) {
+		t.Errorf("ByStatus = %v, want %v", stats.ByStatus, want)
+	}
+	if !stats.LastExpired.Equal(placed.Add(2 * time.Hour)) {
+		t.Errorf("LastExpired = %s, want the last run", stats.LastExpired)
+	}
+
+	// Stats returns a copy the reaper does not write to
+	stats.ByPlanet["Mars"] = 100
+	if r.Stats().ByPlanet["Mars"] != 2 {
+		t.Error("Stats shares its maps with the reaper")
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if _, err := New(func(time.Time) ([]models.Order, error) { return nil, nil }, interval); !errors.Is(err, ErrInvalidInterval) {
+			t.Errorf("New(%s): got %v, want ErrInvalidInterval", interval, err)
+		}
+	}
+
+	runs := make(chan struct{}, 1)
+	r, err := New(func(time.Time) ([]models.Order, error) {
+		select {
+		case runs <- struct{}{}:
+		default:
+		}
+		return nil, nil
+	}, time.Millisecond)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	select {
+	case <-runs:
+	case <-time.After(time.Second):
+		t.Error("the reaper never ran")
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
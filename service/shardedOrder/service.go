@@ -0,0 +1,510 @@
+// Package shardedorder spreads orders over several independent order lists, picked by a hash
+// of the OrderID, so workers touching different orders rarely wait for the same lock.
+//
+// Every order gets a float64 ordering key when it is placed: appends take the next integer
+// and inserts take the midpoint between their neighbours. The global order of the list only
+// exists on demand, when a read sorts the orders of every shard by key.
+package shardedorder
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+	cosmicorder "github.com/gleb-korostelev/CosmicPizza.git/service/cosmicOrder"
+	"github.com/gleb-korostelev/CosmicPizza.git/service/storage"
+)
+
+var (
+	_ storage.AuditedOrderStore  = (*ShardedOrderList)(nil)
+	_ storage.ExpiringOrderStore = (*ShardedOrderList)(nil)
+)
+
+// ErrNoOrderingKey is returned when no float64 ordering key is left for a position,
+// even after the keys were spread out again.
+var ErrNoOrderingKey = errors.New("no ordering key left")
+
+// shard is one order list together with the ordering keys of its orders.
+type shard struct {
+	mu   sync.Mutex // mu serializes mutations of the shard so keys and orders stay in sync
+	list *cosmicorder.CosmicOrderList
+	keys map[orderKey]float64
+}
+
+// orderKey identifies one version of an order.
+type orderKey struct {
+	orderID int
+	version int
+}
+
+func keyOf(order models.Order) orderKey {
+	return orderKey{orderID: order.OrderID, version: order.Version}
+}
+
+// assignKey gives the current version of the order the ordering key key unless it already has one,
+// as upserts keep the position of the order they overwrite.
+func (sh *shard) assignKey(orderID int, key func() float64) {
+	order, ok := sh.list.Get(orderID)
+	if !ok {
+		return
+	}
+	if _, ok := sh.keys[keyOf(order)]; !ok {
+		sh.keys[keyOf(order)] = key()
+	}
+}
+
+// ShardedOrderList is an order store split into shards hashed by OrderID.
+// Operations on a single order lock one shard; operations on the whole list
+// (Snapshot, Len, the counts, InsertOrder, MoveOrder, Swap, NextToPrepare, Restore) lock all shards in order.
+// Get only reads one shard list, which locks itself, so it takes no shard lock.
+type ShardedOrderList struct {
+	shards  []*shard
+	nextKey atomic.Uint64 // nextKey is the ordering key of the latest append
+}
+
+// NewService creates a sharded order list with n shards. opts configure every shard,
+// e.g. its menu and pricer.
+func NewService(n int, opts ...cosmicorder.Option) *ShardedOrderList {
+	s := &ShardedOrderList{shards: make([]*shard, max(n, 1))}
+	for i := range s.shards {
+		s.shards[i] = &shard{list: cosmicorder.NewService(opts...), keys: make(map[orderKey]float64)}
+	}
+	return s
+}
+
+// PlaceOrder validates and appends an order.
+func (s *ShardedOrderList) PlaceOrder(order models.Order) error {
+	return s.PlaceOrderAs(cosmicorder.SystemActor, order)
+}
+
+// PlaceOrderAs is PlaceOrder recording actor in the audit trail of the order's shard.
+func (s *ShardedOrderList) PlaceOrderAs(actor string, order models.Order) error {
+	sh := s.shardOf(order.OrderID)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if err := sh.list.PlaceOrderAs(actor, order); err != nil {
+		return err
+	}
+	sh.assignKey(order.OrderID, func() float64 { return float64(s.nextKey.Add(1)) })
+	return nil
+}
+
+// InsertOrder inserts an order at a specific position of the global order.
+// It returns ErrIndexOutOfRange if index is negative or bigger than the list,
+// and ErrDuplicateOrder if an order with the same ID is already stored.
+func (s *ShardedOrderList) InsertOrder(index, orderID int, planet, pizzaType string) error {
+	s.lockAll()
+	defer s.unlockAll()
+
+	length := len(s.sortedKeys(orderKey{}))
+	if index < 0 || index > length {
+		return fmt.Errorf("insert order #%d at %d (length %d): %w", orderID, index, length, cosmicorder.ErrIndexOutOfRange)
+	}
+
+	key, err := s.keyAt(index, orderKey{})
+	if err != nil {
+		return fmt.Errorf("insert order #%d: %w", orderID, err)
+	}
+	sh := s.shardOf(orderID)
+	if err := sh.list.InsertOrder(sh.rank(key, orderKey{}), orderID, planet, pizzaType); err != nil {
+		return err
+	}
+	sh.assignKey(orderID, func() float64 { return key })
+	return nil
+}
+
+// RemoveOrder removes the order with the given ID.
+func (s *ShardedOrderList) RemoveOrder(orderID int) error {
+	return s.RemoveOrderAs(cosmicorder.SystemActor, orderID)
+}
+
+// RemoveOrderAs is RemoveOrder recording actor in the audit trail of the order's shard.
+func (s *ShardedOrderList) RemoveOrderAs(actor string, orderID int) error {
+	sh := s.shardOf(orderID)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	order, _ := sh.list.Get(orderID)
+	if err := sh.list.RemoveOrderAs(actor, orderID); err != nil {
+		return err
+	}
+	delete(sh.keys, keyOf(order))
+	return nil
+}
+
+// UpdateOrder edits the planet and the pizza type of an order, checking the revision the edit was based on.
+func (s *ShardedOrderList) UpdateOrder(orderID int, patch models.OrderPatch) (models.Order, error) {
+	sh := s.shardOf(orderID)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return sh.list.UpdateOrder(orderID, patch)
+}
+
+// MoveOrder moves an order to position index of the global order by giving it a new ordering key.
+// The order also moves within its shard, so the kitchen serves it in its new place among equal
+// orders, and the shard records the move in its audit trail and event feed.
+// It returns ErrIndexOutOfRange if index is negative or not smaller than the list.
+func (s *ShardedOrderList) MoveOrder(orderID, index int) error {
+	s.lockAll()
+	defer s.unlockAll()
+
+	sh := s.shardOf(orderID)
+	order, ok := sh.list.Get(orderID)
+	if !ok {
+		return fmt.Errorf("move order #%d: %w", orderID, cosmicorder.ErrOrderNotFound)
+	}
+	length := len(s.sortedKeys(orderKey{}))
+	if index < 0 || index >= length {
+		return fmt.Errorf("move order #%d to %d (length %d): %w", orderID, index, length, cosmicorder.ErrIndexOutOfRange)
+	}
+
+	key, err := s.keyAt(index, keyOf(order))
+	if err != nil {
+		return fmt.Errorf("move order #%d: %w", orderID, err)
+	}
+	sh.keys[keyOf(order)] = key
+	return sh.follow(order)
+}
+
+// Swap exchanges the positions of two orders by exchanging their ordering keys.
+// Both orders also move within their shards, like with MoveOrder.
+func (s *ShardedOrderList) Swap(a, b int) error {
+	s.lockAll()
+	defer s.unlockAll()
+
+	shA, shB := s.shardOf(a), s.shardOf(b)
+	orderA, ok := shA.list.Get(a)
+	if !ok {
+		return fmt.Errorf("swap orders #%d and #%d: order #%d: %w", a, b, a, cosmicorder.ErrOrderNotFound)
+	}
+	orderB, ok := shB.list.Get(b)
+	if !ok {
+		return fmt.Errorf("swap orders #%d and #%d: order #%d: %w", a, b, b, cosmicorder.ErrOrderNotFound)
+	}
+
+	keyA, keyB := keyOf(orderA), keyOf(orderB)
+	shA.keys[keyA], shB.keys[keyB] = shB.keys[keyB], shA.keys[keyA]
+	if shA == shB {
+		return shA.list.Swap(a, b)
+	}
+	return errors.Join(shA.follow(orderA), shB.follow(orderB))
+}
+
+// follow moves the order within the shard list to the place its ordering key gives it
+// among the other orders of the shard. sh.mu must be held.
+func (sh *shard) follow(order models.Order) error {
+	return sh.list.MoveOrder(order.OrderID, sh.rank(sh.keys[keyOf(order)], keyOf(order)))
+}
+
+// rank returns the number of orders of the shard, except skip, that sort before key.
+// The shard list keeps its orders in key order, so it is the position key belongs at. sh.mu must be held.
+func (sh *shard) rank(key float64, skip orderKey) int {
+	rank := 0
+	for id, other := range sh.keys {
+		if id != skip && other < key {
+			rank++
+		}
+	}
+	return rank
+}
+
+// Advance moves an order to the next status of its lifecycle.
+func (s *ShardedOrderList) Advance(orderID int, status models.OrderStatus) error {
+	sh := s.shardOf(orderID)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return sh.list.Advance(orderID, status)
+}
+
+// Checkout prices an order and attaches the receipt to it.
+func (s *ShardedOrderList) Checkout(orderID int, promoCode string) (models.Receipt, error) {
+	sh := s.shardOf(orderID)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return sh.list.Checkout(orderID, promoCode)
+}
+
+// AttachReceipt attaches a receipt priced earlier to an order.
+func (s *ShardedOrderList) AttachReceipt(orderID int, receipt models.Receipt) error {
+	sh := s.shardOf(orderID)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return sh.list.AttachReceipt(orderID, receipt)
+}
+
+// NextToPrepare takes the most urgent placed order of all shards and moves it to Preparing.
+// Orders the kitchen considers equal are served roughly in list order: every shard offers
+// its own earliest arrival and the one placed earliest in the global order wins.
+func (s *ShardedOrderList) NextToPrepare() (models.Order, error) {
+	s.lockAll()
+	defer s.unlockAll()
+
+	var (
+		best     *shard
+		bestNext models.Order
+	)
+	for _, sh := range s.shards {
+		next, ok := sh.list.PeekNext()
+		if !ok {
+			continue
+		}
+		if best == nil || cosmicorder.PreparesBefore(next, bestNext) ||
+			(!cosmicorder.PreparesBefore(bestNext, next) && sh.keys[keyOf(next)] < best.keys[keyOf(bestNext)]) {
+			best, bestNext = sh, next
+		}
+	}
+	if best == nil {
+		return models.Order{}, cosmicorder.ErrNothingToPrepare
+	}
+	return best.list.NextToPrepare()
+}
+
+// Expire cancels or removes the placed orders of every shard that expired by now.
+// Shards are expired one after the other, so the result is sorted per shard only.
+func (s *ShardedOrderList) Expire(now time.Time) ([]models.Order, error) {
+	var expired []models.Order
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		orders, err := sh.list.Expire(now)
+		expired = append(expired, sh.forget(orders)...)
+		sh.mu.Unlock()
+		if err != nil {
+			return expired, err
+		}
+	}
+	return expired, nil
+}
+
+// ExpireOrders expires the listed placed orders whether they are due or not, shard by shard.
+func (s *ShardedOrderList) ExpireOrders(now time.Time, orderIDs []int) ([]models.Order, error) {
+	parts := make([][]int, len(s.shards))
+	for _, orderID := range orderIDs {
+		n := s.shardIndex(orderID)
+		parts[n] = append(parts[n], orderID)
+	}
+
+	var expired []models.Order
+	for i, sh := range s.shards {
+		if len(parts[i]) == 0 {
+			continue
+		}
+		sh.mu.Lock()
+		orders, err := sh.list.ExpireOrders(now, parts[i])
+		expired = append(expired, sh.forget(orders)...)
+		sh.mu.Unlock()
+		if err != nil {
+			return expired, err
+		}
+	}
+	return expired, nil
+}
+
+// forget drops the ordering keys of the expired orders that were removed from the shard
+// and returns the expired orders. sh.mu must be held.
+func (sh *shard) forget(expired []models.Order) []models.Order {
+	for _, order := range expired {
+		if !slices.ContainsFunc(sh.list.Versions(order.OrderID), func(o models.Order) bool { return o.Version == order.Version }) {
+			delete(sh.keys, keyOf(order))
+		}
+	}
+	return expired
+}
+
+// Restore replaces all orders, keeping their status, history and receipt, in the given order.
+func (s *ShardedOrderList) Restore(orders []models.Order) error {
+	s.lockAll()
+	defer s.unlockAll()
+
+	parts := make([][]models.Order, len(s.shards))
+	keys := make([]map[orderKey]float64, len(s.shards))
+	for i := range keys {
+		keys[i] = make(map[orderKey]float64)
+	}
+	for i, order := range orders {
+		order.Version = max(order.Version, 1)
+		n := s.shardIndex(order.OrderID)
+		if _, ok := keys[n][keyOf(order)]; ok {
+			return fmt.Errorf("restore order #%d version %d: %w", order.OrderID, order.Version, cosmicorder.ErrDuplicateOrder)
+		}
+		parts[n] = append(parts[n], order)
+		keys[n][keyOf(order)] = float64(i + 1)
+	}
+
+	for i, sh := range s.shards {
+		if err := sh.list.Restore(parts[i]); err != nil {
+			return err
+		}
+		sh.keys = keys[i]
+	}
+	s.nextKey.Store(uint64(len(orders)))
+	return nil
+}
+
+// Get returns the order with the given ID.
+func (s *ShardedOrderList) Get(orderID int) (models.Order, bool) {
+	return s.shardOf(orderID).list.Get(orderID)
+}
+
+// Len returns the number of orders.
+func (s *ShardedOrderList) Len() int {
+	s.lockAll()
+	defer s.unlockAll()
+
+	total := 0
+	for _, sh := range s.shards {
+		total += sh.list.Len()
+	}
+	return total
+}
+
+// Snapshot returns a copy of all orders in global list order.
+func (s *ShardedOrderList) Snapshot() []models.Order {
+	s.lockAll()
+	defer s.unlockAll()
+
+	type keyed struct {
+		key   float64
+		order models.Order
+	}
+	var all []keyed
+	for _, sh := range s.shards {
+		for _, order := range sh.list.Snapshot() {
+			all = append(all, keyed{key: sh.keys[keyOf(order)], order: order})
+		}
+	}
+	slices.SortFunc(all, func(a, b keyed) int { return cmp.Compare(a.key, b.key) })
+
+	orders := make([]models.Order, len(all))
+	for i, k := range all {
+		orders[i] = k.order
+	}
+	return orders
+}
+
+// All returns an iterator over the orders in global list order.
+// The iterator walks a snapshot taken when iteration starts.
+func (s *ShardedOrderList) All() iter.Seq[models.Order] {
+	return func(yield func(models.Order) bool) {
+		for _, order := range s.Snapshot() {
+			if !yield(order) {
+				return
+			}
+		}
+	}
+}
+
+// CountByPlanet returns the number of orders per planet.
+func (s *ShardedOrderList) CountByPlanet() map[string]int {
+	return s.merge((*cosmicorder.CosmicOrderList).CountByPlanet)
+}
+
+// CountByPizzaType returns the number of orders containing each pizza type.
+func (s *ShardedOrderList) CountByPizzaType() map[string]int {
+	return s.merge((*cosmicorder.CosmicOrderList).CountByPizzaType)
+}
+
+// merge sums the counts of every shard.
+func (s *ShardedOrderList) merge(count func(*cosmicorder.CosmicOrderList) map[string]int) map[string]int {
+	s.lockAll()
+	defer s.unlockAll()
+
+	total := make(map[string]int)
+	for _, sh := range s.shards {
+		for key, n := range count(sh.list) {
+			total[key] += n
+		}
+	}
+	return total
+}
+
+// shardIndex hashes an OrderID to a shard with Fibonacci hashing, so consecutive IDs spread out.
+func (s *ShardedOrderList) shardIndex(orderID int) int {
+	h := uint64(orderID) * 0x9E3779B97F4A7C15
+	return int((h >> 32) % uint64(len(s.shards)))
+}
+
+func (s *ShardedOrderList) shardOf(orderID int) *shard {
+	return s.shards[s.shardIndex(orderID)]
+}
+
+// lockAll locks every shard, always in the same order to avoid deadlocks.
+func (s *ShardedOrderList) lockAll() {
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+	}
+}
+
+func (s *ShardedOrderList) unlockAll() {
+	for _, sh := range s.shards {
+		sh.mu.Unlock()
+	}
+}
+
+// sortedKeys returns the ordering keys of all orders except skip in ascending order. All shards must be locked.
+func (s *ShardedOrderList) sortedKeys(skip orderKey) []float64 {
+	var keys []float64
+	for _, sh := range s.shards {
+		for id, key := range sh.keys {
+			if id != skip {
+				keys = append(keys, key)
+			}
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// keyAt returns an ordering key that sorts at position index among the keys of all orders
+// except skip. It returns ErrNoOrderingKey if no key fits even after renumbering. All shards must be locked.
+func (s *ShardedOrderList) keyAt(index int, skip orderKey) (float64, error) {
+	sorted := s.sortedKeys(skip)
+	if index == len(sorted) {
+		return float64(s.nextKey.Add(1)), nil
+	}
+	if key, ok := keyBetween(sorted, index); ok {
+		return key, nil
+	}
+	// The neighbours are too close for a float64 in between, spread all keys out again
+	s.renumber()
+	if key, ok := keyBetween(s.sortedKeys(skip), index); ok {
+		return key, nil
+	}
+	return 0, fmt.Errorf("key at %d of %d: %w", index, len(sorted), ErrNoOrderingKey)
+}
+
+// renumber gives the orders the keys 1..n in their current order. All shards must be locked.
+func (s *ShardedOrderList) renumber() {
+	sorted := s.sortedKeys(orderKey{})
+	rank := make(map[float64]float64, len(sorted))
+	for i, key := range sorted {
+		rank[key] = float64(i + 1)
+	}
+	for _, sh := range s.shards {
+		for id, key := range sh.keys {
+			sh.keys[id] = rank[key]
+		}
+	}
+	s.nextKey.Store(uint64(len(sorted)))
+}
+
+// keyBetween returns a key that sorts at position index of the sorted keys, before the last one.
+// It returns false if the neighbours leave no room for a new float64 in between.
+func keyBetween(sorted []float64, index int) (float64, bool) {
+	if index == 0 {
+		return sorted[0] - 1, true
+	}
+	lo, hi := sorted[index-1], sorted[index]
+	mid := lo + (hi-lo)/2
+	return mid, mid > lo && mid < hi
+}
@@ -0,0 +1,151 @@
+package shardedorder
+
+import (
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+	cosmicorder "github.com/gleb-korostelev/CosmicPizza.git/service/cosmicOrder"
+	"github.com/gleb-korostelev/CosmicPizza.git/service/storage"
+)
+
+// newList places orders 1..n, all equal for the kitchen, spread over the shards.
+func newList(t *testing.T, n int) *ShardedOrderList {
+	t.Helper()
+
+	list := NewService(3)
+	for id := 1; id <= n; id++ {
+		if err := list.PlaceOrder(models.Order{OrderID: id, Planet: "Mars", PizzaType: "Galactic Cheese"}); err != nil {
+			t.Fatalf("place order #%d: %v", id, err)
+		}
+	}
+	return list
+}
+
+// ids returns the OrderIDs of orders.
+func ids(orders []models.Order) []int {
+	ids := make([]int, len(orders))
+	for i, order := range orders {
+		ids[i] = order.OrderID
+	}
+	return ids
+}
+
+// kitchenOrder takes every order out of the kitchen queue and returns their IDs.
+func kitchenOrder(t *testing.T, list *ShardedOrderList) []int {
+	t.Helper()
+
+	var prepared []int
+	for range list.Len() {
+		order, err := list.NextToPrepare()
+		if err != nil {
+			t.Fatalf("NextToPrepare: %v", err)
+		}
+		prepared = append(prepared, order.OrderID)
+	}
+	return prepared
+}
+
+func TestReorderingChangesKitchenOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		reorder func(*ShardedOrderList) error
+		want    []int
+	}{
+		{name: "move to front", reorder: func(l *ShardedOrderList) error { return l.MoveOrder(6, 0) }, want: []int{6, 1, 2, 3, 4, 5}},
+		{name: "move to back", reorder: func(l *ShardedOrderList) error { return l.MoveOrder(1, 5) }, want: []int{2, 3, 4, 5, 6, 1}},
+		{name: "move inside", reorder: func(l *ShardedOrderList) error { return l.MoveOrder(2, 4) }, want: []int{1, 3, 4, 5, 2, 6}},
+		{name: "swap", reorder: func(l *ShardedOrderList) error { return l.Swap(1, 5) }, want: []int{5, 2, 3, 4, 1, 6}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list := newList(t, 6)
+			if err := tt.reorder(list); err != nil {
+				t.Fatalf("reorder: %v", err)
+			}
+			if got := ids(list.Snapshot()); !slices.Equal(got, tt.want) {
+				t.Errorf("list order = %v, want %v", got, tt.want)
+			}
+			if got := kitchenOrder(t, list); !slices.Equal(got, tt.want) {
+				t.Errorf("kitchen order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReorderingIsAudited(t *testing.T) {
+	list := newList(t, 6)
+	if err := list.MoveOrder(6, 0); err != nil {
+		t.Fatalf("MoveOrder: %v", err)
+	}
+	if err := list.Swap(1, 2); err != nil {
+		t.Fatalf("Swap: %v", err)
+	}
+
+	moved := make(map[int]int)
+	for _, sh := range list.shards {
+		for _, entry := range sh.list.AuditLog() {
+			if entry.Action == models.AuditMoved {
+				moved[entry.OrderID]++
+			}
+		}
+	}
+	for _, id := range []int{6, 1, 2} {
+		if moved[id] == 0 {
+			t.Errorf("move of order #%d is not in the audit trail of its shard", id)
+		}
+	}
+}
+
+func TestInsertRenumbersKeys(t *testing.T) {
+	list := newList(t, 2)
+
+	// Every insert halves the gap after order #1, until the keys must be spread out again
+	for id := 100; id > 2; id-- {
+		if err := list.InsertOrder(1, id, "Mars", "Galactic Cheese"); err != nil {
+			t.Fatalf("insert order #%d: %v", id, err)
+		}
+	}
+	want := []int{1}
+	for id := 3; id <= 100; id++ {
+		want = append(want, id)
+	}
+	want = append(want, 2)
+
+	if got := ids(list.Snapshot()); !slices.Equal(got, want) {
+		t.Fatalf("Snapshot = %v, want %v", got, want)
+	}
+	if err := list.MoveOrder(2, 0); err != nil {
+		t.Fatalf("MoveOrder: %v", err)
+	}
+	if got := ids(list.Snapshot()); got[0] != 2 || got[1] != 1 || len(got) != len(want) {
+		t.Errorf("Snapshot after moving order #2 to the front = %v", got)
+	}
+}
+
+// BenchmarkConcurrentOrders places, reads, advances and removes orders from many goroutines at once,
+// on a single CosmicOrderList and on a ShardedOrderList.
+func BenchmarkConcurrentOrders(b *testing.B) {
+	for _, bench := range []struct {
+		name string
+		list storage.OrderStore
+	}{
+		{name: "single", list: cosmicorder.NewService()},
+		{name: "sharded", list: NewService(32)},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			var nextID atomic.Int64
+			b.SetParallelism(64)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					id := int(nextID.Add(1))
+					bench.list.PlaceOrder(models.Order{OrderID: id, Planet: "Mars", PizzaType: "Galactic Cheese"})
+					bench.list.Get(id)
+					bench.list.Advance(id, models.StatusPreparing)
+					bench.list.RemoveOrder(id)
+				}
+			})
+		})
+	}
+}
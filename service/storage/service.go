@@ -0,0 +1,100 @@
+// Package storage defines the interfaces the task processing code uses to reach orders and ingredients,
+// so the in-memory structures can be swapped for other backends.
+package storage
+
+import (
+	"iter"
+	"time"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+)
+
+// OrderStore keeps orders in placement order.
+type OrderStore interface {
+	// PlaceOrder validates and appends an order.
+	PlaceOrder(order models.Order) error
+	// RemoveOrder removes the order with the given ID.
+	RemoveOrder(orderID int) error
+	// Advance moves an order to the next status of its lifecycle.
+	Advance(orderID int, status models.OrderStatus) error
+	// Checkout prices an order and attaches the receipt to it.
+	Checkout(orderID int, promoCode string) (models.Receipt, error)
+	// AttachReceipt attaches a receipt priced earlier, e.g. when a checkout is replayed.
+	AttachReceipt(orderID int, receipt models.Receipt) error
+	// UpdateOrder edits the planet and the pizza type of an order, checking the revision the edit was based on.
+	UpdateOrder(orderID int, patch models.OrderPatch) (models.Order, error)
+	// MoveOrder moves an order to another position.
+	MoveOrder(orderID, index int) error
+	// Swap exchanges the positions of two orders.
+	Swap(a, b int) error
+	// NextToPrepare takes the most urgent placed order and moves it to Preparing.
+	// It returns cosmicorder.ErrNothingToPrepare if no order is waiting.
+	NextToPrepare() (models.Order, error)
+	// Restore replaces all orders, keeping their status, history and receipt.
+	Restore(orders []models.Order) error
+
+	// Get returns the order with the given ID.
+	Get(orderID int) (models.Order, bool)
+	// Len returns the number of orders.
+	Len() int
+	// Snapshot returns a copy of all orders in placement order.
+	Snapshot() []models.Order
+	// All returns an iterator over the orders in placement order.
+	All() iter.Seq[models.Order]
+	// CountByPlanet returns the number of orders per planet.
+	CountByPlanet() map[string]int
+	// CountByPizzaType returns the number of orders containing each pizza type.
+	CountByPizzaType() map[string]int
+}
+
+// AuditedOrderStore is implemented by order stores that record who changed an order.
+type AuditedOrderStore interface {
+	OrderStore
+
+	// PlaceOrderAs is PlaceOrder recording actor in the audit trail.
+	PlaceOrderAs(actor string, order models.Order) error
+	// RemoveOrderAs is RemoveOrder recording actor in the audit trail.
+	RemoveOrderAs(actor string, orderID int) error
+}
+
+// ExpiringOrderStore is implemented by order stores whose placed orders expire.
+type ExpiringOrderStore interface {
+	OrderStore
+
+	// Expire cancels or removes the placed orders that expired by now and returns them.
+	Expire(now time.Time) ([]models.Order, error)
+	// ExpireOrders expires the listed placed orders whether they are due or not, e.g. to replay an Expire.
+	ExpireOrders(now time.Time, orderIDs []int) ([]models.Order, error)
+}
+
+// RevertibleOrderStore is implemented by order stores that can undo changes recorded in their audit trail.
+type RevertibleOrderStore interface {
+	AuditedOrderStore
+
+	// Undo reverts the last n changes and returns the Seqs of the reverted audit entries.
+	Undo(actor string, n int) ([]uint64, error)
+	// RevertTo reverts every change made after t and returns the Seqs of the reverted audit entries.
+	RevertTo(actor string, t time.Time) ([]uint64, error)
+	// Revert reverts the audit entries with the given Seqs, e.g. to replay an Undo or a RevertTo.
+	Revert(actor string, seqs []uint64) error
+	// AuditLog returns the audit trail, oldest first.
+	AuditLog() []models.AuditEntry
+	// RestoreAudit replaces the audit trail, e.g. after Restore.
+	RestoreAudit(entries []models.AuditEntry) error
+}
+
+// IngredientStore keeps a set of unique ingredient values.
+type IngredientStore interface {
+	// Insert adds a single ingredient.
+	Insert(value int) error
+	// InsertBatch adds several ingredients, skipping and reporting duplicates, including repeats within the batch.
+	InsertBatch(values []int) error
+	// Delete removes a single ingredient.
+	Delete(value int) error
+	// Search reports whether the ingredient is stored.
+	Search(value int) bool
+	// TraverseInOrder returns all ingredients in ascending order.
+	TraverseInOrder() []int
+	// FindMinMaxSum returns the smallest and the biggest ingredient and the sum of all of them.
+	FindMinMaxSum() (min int, max int, sum int)
+}
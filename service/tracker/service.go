@@ -0,0 +1,206 @@
+// Package tracker follows tasks end to end through the fan-out/worker pipeline.
+// Every stage reports the tasks it handles and the tracker detects tasks that were
+// lost, processed more than once or stuck inside a worker.
+//
+// All methods are safe on a nil *Tracker, so tracking can be switched off by passing nil.
+package tracker
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+)
+
+// Stage is a point of the pipeline a task went through.
+type Stage int
+
+const (
+	StageCreated Stage = iota
+	StageEnqueued
+	StageStarted
+	StageFinished
+	StageCollected
+)
+
+func (s Stage) String() string {
+	switch s {
+	case StageCreated:
+		return "created"
+	case StageEnqueued:
+		return "enqueued"
+	case StageStarted:
+		return "started"
+	case StageFinished:
+		return "finished"
+	case StageCollected:
+		return "collected"
+	}
+	return fmt.Sprintf("stage(%d)", int(s))
+}
+
+// Entry is the tracking state of a single task.
+type Entry struct {
+	Task   models.Task   // Task holds the latest known timestamps of the task.
+	Stage  Stage         // Stage is the furthest stage the task reached.
+	Counts map[Stage]int // Counts is how many times the task was seen at each stage.
+}
+
+// Report summarizes the state of all tracked tasks.
+type Report struct {
+	Total      int     // Total number of tracked tasks.
+	Completed  int     // Completed tasks were finished and collected exactly once.
+	InFlight   []Entry // InFlight tasks were active within the stuck threshold.
+	Stuck      []Entry // Stuck tasks were started but not finished in time.
+	Lost       []Entry // Lost tasks stopped making progress before being collected.
+	Duplicated []Entry // Duplicated tasks were seen more than once at some stage.
+}
+
+// Summary returns a one-line description of the report.
+func (r Report) Summary() string {
+	return fmt.Sprintf("total=%d completed=%d in-flight=%d stuck=%d lost=%d duplicated=%d",
+		r.Total, r.Completed, len(r.InFlight), len(r.Stuck), len(r.Lost), len(r.Duplicated))
+}
+
+// Tracker records the progress of tasks by ID.
+type Tracker struct {
+	mu    sync.Mutex
+	tasks map[string]*Entry
+}
+
+// New creates an empty Tracker.
+func New() *Tracker {
+	return &Tracker{tasks: make(map[string]*Entry)}
+}
+
+// Created registers a newly generated task.
+func (t *Tracker) Created(task models.Task) models.Task {
+	if task.CreatedAt.IsZero() {
+		task.CreatedAt = time.Now()
+	}
+	t.record(StageCreated, task)
+	return task
+}
+
+// Enqueued marks the task as handed to the fan-out.
+func (t *Tracker) Enqueued(task models.Task) models.Task {
+	task.EnqueuedAt = time.Now()
+	t.record(StageEnqueued, task)
+	return task
+}
+
+// Started marks the task as picked up by a worker.
+func (t *Tracker) Started(task models.Task) models.Task {
+	task.StartedAt = time.Now()
+	t.record(StageStarted, task)
+	return task
+}
+
+// Finished marks the task as processed by a worker.
+func (t *Tracker) Finished(task models.Task) models.Task {
+	task.FinishedAt = time.Now()
+	t.record(StageFinished, task)
+	return task
+}
+
+// Collected marks the task as received by the result collector.
+func (t *Tracker) Collected(task models.Task) {
+	t.record(StageCollected, task)
+}
+
+// record stores the stage and merges the timestamps carried by task.
+func (t *Tracker) record(stage Stage, task models.Task) {
+	if t == nil || task.ID == "" {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.tasks[task.ID]
+	if !ok {
+		entry = &Entry{Task: task, Counts: make(map[Stage]int)}
+		t.tasks[task.ID] = entry
+	}
+	entry.Counts[stage]++
+	if stage > entry.Stage {
+		entry.Stage = stage
+	}
+	mergeTimestamps(&entry.Task, task)
+}
+
+// Report classifies every tracked task. Tasks without activity for longer than
+// stuckAfter are reported as stuck or lost, the others as in flight.
+func (t *Tracker) Report(stuckAfter time.Duration) Report {
+	if t == nil {
+		return Report{}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	report := Report{Total: len(t.tasks)}
+	for _, e := range t.tasks {
+		entry := Entry{Task: e.Task, Stage: e.Stage, Counts: make(map[Stage]int, len(e.Counts))}
+		for stage, count := range e.Counts {
+			entry.Counts[stage] = count
+		}
+
+		duplicated := false
+		for stage, count := range entry.Counts {
+			if stage != StageCreated && count > 1 {
+				duplicated = true
+			}
+		}
+		if duplicated {
+			report.Duplicated = append(report.Duplicated, entry)
+		}
+
+		switch {
+		case entry.Counts[StageCollected] > 0 && entry.Counts[StageFinished] > 0:
+			if !duplicated {
+				report.Completed++
+			}
+		case now.Sub(lastActivity(entry.Task)) < stuckAfter:
+			report.InFlight = append(report.InFlight, entry)
+		case entry.Counts[StageStarted] > 0 && entry.Counts[StageFinished] == 0:
+			report.Stuck = append(report.Stuck, entry)
+		default:
+			report.Lost = append(report.Lost, entry)
+		}
+	}
+
+	for _, entries := range [][]Entry{report.InFlight, report.Stuck, report.Lost, report.Duplicated} {
+		slices.SortFunc(entries, func(a, b Entry) int { return cmp.Compare(a.Task.Seq, b.Task.Seq) })
+	}
+	return report
+}
+
+// mergeTimestamps copies the timestamps set in src into dst.
+func mergeTimestamps(dst *models.Task, src models.Task) {
+	for _, ts := range []struct{ dst, src *time.Time }{
+		{&dst.CreatedAt, &src.CreatedAt},
+		{&dst.EnqueuedAt, &src.EnqueuedAt},
+		{&dst.StartedAt, &src.StartedAt},
+		{&dst.FinishedAt, &src.FinishedAt},
+	} {
+		if !ts.src.IsZero() {
+			*ts.dst = *ts.src
+		}
+	}
+}
+
+// lastActivity returns the latest timestamp of the task.
+func lastActivity(task models.Task) time.Time {
+	last := task.CreatedAt
+	for _, ts := range []time.Time{task.EnqueuedAt, task.StartedAt, task.FinishedAt} {
+		if ts.After(last) {
+			last = ts
+		}
+	}
+	return last
+}
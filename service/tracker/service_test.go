@@ -0,0 +1,98 @@
+package tracker
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+)
+
+func TestReport(t *testing.T) {
+	tr := New()
+
+	// stages are the pipeline stages every task went through, in order
+	tasks := []struct {
+		id     string
+		stages []Stage
+	}{
+		{"completed", []Stage{StageCreated, StageEnqueued, StageStarted, StageFinished, StageCollected}},
+		{"never started", []Stage{StageCreated, StageEnqueued}},
+		{"stuck in a worker", []Stage{StageCreated, StageEnqueued, StageStarted}},
+		{"processed twice", []Stage{StageCreated, StageEnqueued, StageStarted, StageFinished, StageStarted, StageFinished, StageCollected, StageCollected}},
+		{"never collected", []Stage{StageCreated, StageEnqueued, StageStarted, StageFinished}},
+		{"collected twice", []Stage{StageCreated, StageEnqueued, StageStarted, StageFinished, StageCollected, StageCollected}},
+	}
+	for seq, task := range tasks {
+		mt := models.Task{ID: task.id, Seq: uint64(seq + 1)}
+		for _, stage := range task.stages {
+			switch stage {
+			case StageCreated:
+				mt = tr.Created(mt)
+			case StageEnqueued:
+				mt = tr.Enqueued(mt)
+			case StageStarted:
+				mt = tr.Started(mt)
+			case StageFinished:
+				mt = tr.Finished(mt)
+			case StageCollected:
+				tr.Collected(mt)
+			}
+		}
+	}
+	ids := func(entries []Entry) []string {
+		var ids []string
+		for _, entry := range entries {
+			ids = append(ids, entry.Task.ID)
+		}
+		return ids
+	}
+
+	// Within the threshold every unfinished task is still in flight
+	report := tr.Report(time.Hour)
+	if report.Total != len(tasks) || report.Completed != 1 {
+		t.Errorf("Total %d Completed %d, want %d and 1", report.Total, report.Completed, len(tasks))
+	}
+	if got, want := ids(report.InFlight), []string{"never started", "stuck in a worker", "never collected"}; !slices.Equal(got, want) {
+		t.Errorf("InFlight = %v, want %v", got, want)
+	}
+	if len(report.Stuck) != 0 || len(report.Lost) != 0 {
+		t.Errorf("Stuck %v Lost %v before the threshold", ids(report.Stuck), ids(report.Lost))
+	}
+	if got, want := ids(report.Duplicated), []string{"processed twice", "collected twice"}; !slices.Equal(got, want) {
+		t.Errorf("Duplicated = %v, want %v", got, want)
+	}
+
+	// Past the threshold a started task is stuck and the others are lost
+	time.Sleep(time.Millisecond)
+	report = tr.Report(time.Nanosecond)
+	if len(report.InFlight) != 0 {
+		t.Errorf("InFlight = %v past the threshold", ids(report.InFlight))
+	}
+	if got, want := ids(report.Stuck), []string{"stuck in a worker"}; !slices.Equal(got, want) {
+		t.Errorf("Stuck = %v, want %v", got, want)
+	}
+	if got, want := ids(report.Lost), []string{"never started", "never collected"}; !slices.Equal(got, want) {
+		t.Errorf("Lost = %v, want %v", got, want)
+	}
+	if got, want := report.Summary(), "total=6 completed=1 in-flight=0 stuck=1 lost=2 duplicated=2"; got != want {
+		t.Errorf("Summary = %q, want %q", got, want)
+	}
+
+	dup := report.Duplicated[0]
+	if dup.Stage != StageCollected || dup.Counts[StageStarted] != 2 || dup.Counts[StageFinished] != 2 {
+		t.Errorf("processed twice: stage %s counts %v", dup.Stage, dup.Counts)
+	}
+}
+
+func TestNilTracker(t *testing.T) {
+	var tr *Tracker
+	task := tr.Finished(tr.Started(tr.Created(models.Task{ID: "task"})))
+	tr.Collected(task)
+	if task.CreatedAt.IsZero() || task.FinishedAt.IsZero() {
+		t.Errorf("a nil tracker did not stamp the task: %+v", task)
+	}
+	if report := tr.Report(time.Hour); report.Total != 0 {
+		t.Errorf("Report of a nil tracker = %+v", report)
+	}
+}
@@ -47,7 +47,7 @@ func (p *WorkerPool) worker() {
 	for task := range p.taskQueue {
 		// logger.Infof("WorkerPoolService: Task sent to be executed: %+v", task)
 		if err := task.Action(context.Background()); err != nil {
-			logger.Infof("Error executing task: %v", err)
+			logger.Errorf("Error executing task: %v", err)
 		}
 		if task.Done != nil {
 			close(task.Done)
@@ -0,0 +1,58 @@
+package testfunctions
+
+import (
+	"time"
+
+	cosmicorder "github.com/gleb-korostelev/CosmicPizza.git/service/cosmicOrder"
+	"github.com/gleb-korostelev/CosmicPizza.git/tools/logger"
+	"github.com/gleb-korostelev/CosmicPizza.git/utils"
+)
+
+// AuditSimulation places and removes orders as different actors, shows who removed an order,
+// then undoes the last changes and reverts the list to an earlier point in time.
+func AuditSimulation(orderList *cosmicorder.CosmicOrderList) {
+	for i := 1; i <= 4; i++ {
+		if err := orderList.PlaceOrderAs("customer:zorg", utils.GenerateRandomOrder(i)); err != nil {
+			logger.Errorf("Cannot place the order: %v", err)
+		}
+	}
+	checkpoint := time.Now()
+	logAuditOrders("After placing", orderList)
+
+	for _, id := range []int{2, 3} {
+		if err := orderList.RemoveOrderAs("dispatcher:ford", id); err != nil {
+			logger.Errorf("Cannot remove the order: %v", err)
+		}
+	}
+	if err := orderList.PlaceOrderAs("customer:leela", utils.GenerateRandomOrder(5)); err != nil {
+		logger.Errorf("Cannot place the order: %v", err)
+	}
+	logAuditOrders("After removing", orderList)
+
+	for _, entry := range orderList.AuditTrail(2) {
+		logger.Infof("Audit order #%d: %s by %s at %s", entry.OrderID, entry.Action, entry.Actor, entry.At.Format(time.StampMicro))
+	}
+
+	if _, err := orderList.Undo("manager:zaphod", 2); err != nil {
+		logger.Errorf("Cannot undo: %v", err)
+	}
+	logAuditOrders("After undoing 2 changes", orderList)
+
+	if _, err := orderList.RevertTo("manager:zaphod", checkpoint); err != nil {
+		logger.Errorf("Cannot revert: %v", err)
+	}
+	logAuditOrders("After reverting to the checkpoint", orderList)
+
+	for _, entry := range orderList.AuditLog() {
+		logger.Infof("Audit %d: %s order #%d by %s (undone %v, reverts %d)", entry.Seq, entry.Action, entry.OrderID, entry.Actor, entry.Undone, entry.Reverts)
+	}
+}
+
+// logAuditOrders logs the IDs of the orders in list order.
+func logAuditOrders(label string, orderList *cosmicorder.CosmicOrderList) {
+	ids := []int{}
+	for order := range orderList.All() {
+		ids = append(ids, order.OrderID)
+	}
+	logger.Infof("%s: orders %v", label, ids)
+}
@@ -0,0 +1,48 @@
+package testfunctions
+
+import (
+	"github.com/gleb-korostelev/CosmicPizza.git/config"
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+	cosmicorder "github.com/gleb-korostelev/CosmicPizza.git/service/cosmicOrder"
+	"github.com/gleb-korostelev/CosmicPizza.git/tools/logger"
+	"github.com/gleb-korostelev/CosmicPizza.git/utils"
+)
+
+// EventFeedSimulation runs a kitchen display for Mars orders that is too slow for the event feed.
+// The display notices the dropped events, reconnects and resumes after the last event it saw.
+func EventFeedSimulation(orderList *cosmicorder.CosmicOrderList) {
+	events, cancel := orderList.Subscribe(cosmicorder.ByPlanet("Mars"), cosmicorder.WithEventBuffer(config.EventBufferSize))
+
+	// Place orders while the display is not reading
+	for i := 1; i <= config.EventOrderNumber; i++ {
+		order := utils.GenerateRandomOrder(i)
+		order.Planet = "Mars"
+		if err := orderList.PlaceOrder(order); err != nil {
+			logger.Errorf("Cannot place the order: %v", err)
+		}
+	}
+
+	last := display(events, len(events))
+	cancel()
+	logger.Infof("Kitchen display: caught up to event %d of %d, %d events dropped", last, orderList.LastEventSeq(), orderList.DroppedEvents())
+
+	// Reconnect with a buffer big enough for the backlog
+	events, cancel = orderList.Subscribe(cosmicorder.ByPlanet("Mars"), cosmicorder.WithEventBuffer(config.EventOrderNumber), cosmicorder.ResumeAfter(last))
+	defer cancel()
+	last = display(events, len(events))
+	logger.Infof("Kitchen display: resumed up to event %d of %d", last, orderList.LastEventSeq())
+}
+
+// display shows n events and returns the sequence number of the last one.
+func display(events <-chan models.OrderEvent, n int) uint64 {
+	var last uint64
+	for range n {
+		event := <-events
+		if event.Dropped > 0 {
+			logger.Errorf("Kitchen display: missed %d events before event %d", event.Dropped, event.Seq)
+		}
+		logger.Infof("Kitchen display: event %d %s order #%d (%s)", event.Seq, event.Type, event.OrderID, event.Order.Status)
+		last = event.Seq
+	}
+	return last
+}
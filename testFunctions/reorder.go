@@ -0,0 +1,46 @@
+package testfunctions
+
+import (
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
+	cosmicorder "github.com/gleb-korostelev/CosmicPizza.git/service/cosmicOrder"
+	"github.com/gleb-korostelev/CosmicPizza.git/tools/logger"
+)
+
+// ReorderSimulation edits an order twice from the same revision, so the second edit is refused,
+// then moves and swaps orders, lets the kitchen pull one and undoes the reordering.
+func ReorderSimulation(orderList *cosmicorder.CosmicOrderList) {
+	for i := 1; i <= 4; i++ {
+		if err := orderList.PlaceOrder(models.Order{OrderID: i, Planet: "Mars", PizzaType: "Galactic Cheese"}); err != nil {
+			logger.Errorf("Cannot place the order: %v", err)
+		}
+	}
+	logAuditOrders("After placing", orderList)
+
+	order, _ := orderList.Get(2)
+	updated, err := orderList.UpdateOrder(2, models.OrderPatch{Planet: "Venus", Revision: order.Revision})
+	if err != nil {
+		logger.Errorf("Cannot update the order: %v", err)
+	}
+	logger.Infof("Order #%d now goes to %s at revision %d", updated.OrderID, updated.Planet, updated.Revision)
+	if _, err := orderList.UpdateOrder(2, models.OrderPatch{PizzaType: "Nebula Deluxe", Revision: order.Revision}); err != nil {
+		logger.Infof("Stale edit refused: %v", err)
+	}
+
+	if err := orderList.MoveOrder(4, 0); err != nil {
+		logger.Errorf("Cannot move the order: %v", err)
+	}
+	logAuditOrders("After moving #4 to the front", orderList)
+	if err := orderList.Swap(1, 3); err != nil {
+		logger.Errorf("Cannot swap the orders: %v", err)
+	}
+	logAuditOrders("After swapping #1 and #3", orderList)
+
+	if next, ok := orderList.PeekNext(); ok {
+		logger.Infof("Kitchen would prepare order #%d next", next.OrderID)
+	}
+
+	if _, err := orderList.Undo("manager:zaphod", 3); err != nil {
+		logger.Errorf("Cannot undo: %v", err)
+	}
+	logAuditOrders("After undoing the reordering", orderList)
+}
@@ -1,30 +1,36 @@
 package testfunctions
 
 import (
+	"context"
 	"sync"
+	"time"
 
 	"github.com/gleb-korostelev/CosmicPizza.git/config"
+	"github.com/gleb-korostelev/CosmicPizza.git/models"
 	cosmicorder "github.com/gleb-korostelev/CosmicPizza.git/service/cosmicOrder"
 	fanout "github.com/gleb-korostelev/CosmicPizza.git/service/fanOut"
-	ingredienttree "github.com/gleb-korostelev/CosmicPizza.git/service/ingredientTree"
+	"github.com/gleb-korostelev/CosmicPizza.git/service/pipeline"
+	"github.com/gleb-korostelev/CosmicPizza.git/service/storage"
+	"github.com/gleb-korostelev/CosmicPizza.git/service/tracker"
 	"github.com/gleb-korostelev/CosmicPizza.git/service/worker"
+	"github.com/gleb-korostelev/CosmicPizza.git/tools/logger"
 	"github.com/gleb-korostelev/CosmicPizza.git/utils"
 )
 
-func WorkerPoolSimulation(orderNumber, ingredientNumber int, orderList *cosmicorder.CosmicOrderList, ingredientTree *ingredienttree.IngredientTree) {
+func WorkerPoolSimulation(orderNumber, ingredientNumber int, orderList storage.OrderStore, ingredientTree storage.IngredientStore) {
 	// Order Worker Pool initialization
 	orderWorkerPool := worker.NewWorkerPool(config.MaxConcurrentWorkerPoolOperations)
 	defer orderWorkerPool.Shutdown()
 
 	var wg sync.WaitGroup
 
-	for i := 1; i <= orderNumber; i++ {
+	for range orderNumber {
 		wg.Add(1)
-		go func(id int) {
+		go func() {
 			defer wg.Done()
-			order := utils.GenerateRandomOrder(id)
+			order := utils.GenerateRandomOrder(utils.OrderIDs.Next())
 			orderWorkerPool.AddTask(utils.ProcessOrder(orderList, order))
-		}(i)
+		}()
 	}
 
 	// Ingredient Worker Pool initialization
@@ -44,15 +50,30 @@ func WorkerPoolSimulation(orderNumber, ingredientNumber int, orderList *cosmicor
 }
 
 func TryInsertBadIndexOrder(orderList *cosmicorder.CosmicOrderList) {
-	orderList.InsertOrder(10000000, 3, "Venus", "Quantum Anchoa")
+	if err := orderList.InsertOrder(10000000, 3, "Venus", "Quantum Anchoa"); err != nil {
+		logger.Errorf("Cannot insert the order: %v", err)
+	}
 }
 
-func TryInsertSameIngredients(ingredientTree *ingredienttree.IngredientTree) {
-	ingredientTree.Insert(7)
-	ingredientTree.Insert(7)
+func TryInsertSameIngredients(ingredientTree storage.IngredientStore) {
+	for range 2 {
+		if err := ingredientTree.Insert(7); err != nil {
+			logger.Errorf("Cannot insert the ingredient: %v", err)
+		}
+	}
 }
 
-func FullConcurrencySimulation(fanoutWorkerNumber int, orderList *cosmicorder.CosmicOrderList, ingredientTree *ingredienttree.IngredientTree) {
+func FullConcurrencySimulation(fanoutWorkerNumber int, orderList storage.OrderStore, ingredientTree storage.IngredientStore, journal utils.Journal) {
+	// Track every task end to end, reported once the worker pool has drained
+	tr := tracker.New()
+	defer func() {
+		report := tr.Report(config.TaskStuckAfter * time.Millisecond)
+		logger.Infof("Task tracking report: %s", report.Summary())
+		for _, entry := range append(append(report.Lost, report.Stuck...), report.Duplicated...) {
+			logger.Errorf("Task %s (seq %d, type %d) at stage %s: %v", entry.Task.ID, entry.Task.Seq, entry.Task.Type, entry.Stage, entry.Counts)
+		}
+	}()
+
 	// Initialize WorkerPool service
 	workerPool := worker.NewWorkerPool(config.MaxConcurrentWorkerPoolOperations)
 	defer workerPool.Shutdown()
@@ -61,20 +82,101 @@ func FullConcurrencySimulation(fanoutWorkerNumber int, orderList *cosmicorder.Co
 
 	// Generate tasks dynamically
 	tasks := utils.GenerateTasks()
+	for i, task := range tasks {
+		tasks[i] = tr.Created(task)
+	}
 
 	doneCh := make(chan struct{})
 	defer close(doneCh)
 
 	// Create input channel for tasks
-	inputCh := utils.ChanGenerator(tasks, doneCh)
+	inputCh := utils.ChanGenerator(tasks, doneCh, tr)
 
 	// Initialize FanOutService
-	fanOut := fanout.NewFanOutService(inputCh, fanoutWorkerNumber)
+	fanOut := fanout.NewFanOutService(inputCh, fanoutWorkerNumber, fanout.WithBufferSize(config.FanOutBufferSize))
 	defer fanOut.Shutdown()
 
 	// Start processing tasks
-	processed := utils.ProcessTasks(workerPool, orderList, ingredientTree, fanOut.GetOutputChannels(), &wg)
+	processed := utils.ProcessTasks(workerPool, orderList, ingredientTree, fanOut.GetOutputChannels(), &wg, tr, journal)
 
 	// Collect final results
-	utils.CollectResults(orderList, ingredientTree, processed)
+	utils.CollectResults(orderList, ingredientTree, processed, tr)
+	logger.Infof("FanOut output stats: %+v", fanOut.Stats())
+}
+
+func PipelineSimulation(fanoutWorkerNumber int, orderList storage.OrderStore, ingredientTree storage.IngredientStore) {
+	// Generate -> fan-out -> process -> fan-in, described as a single pipeline
+	p := pipeline.FromSlice(utils.GenerateTasks()).
+		FanOut(fanoutWorkerNumber).
+		Map(func(ctx context.Context, task models.Task) (models.Task, error) {
+			if err := utils.SwitchProcessTasks(ctx, task, orderList, ingredientTree, nil); err != nil {
+				logger.Errorf("Error processing task %+v: %v", task, err)
+			}
+			return task, nil
+		}, pipeline.WithName("process"), pipeline.WithConcurrency(config.MaxConcurrentWorkerPoolOperations/fanoutWorkerNumber+1)).
+		FanIn()
+
+	processed := make(chan models.Task)
+	go func() {
+		defer close(processed)
+		err := p.Sink(context.Background(), func(ctx context.Context, task models.Task) error {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case processed <- task:
+				return nil
+			}
+		})
+		if err != nil {
+			logger.Errorf("Pipeline stopped: %v", err)
+		}
+	}()
+
+	// Collect final results
+	utils.CollectResults(orderList, ingredientTree, processed, nil)
+}
+
+func WindowedPipelineSimulation(orderList storage.OrderStore, ingredientTree storage.IngredientStore) {
+	tasks := utils.GenerateTasks()
+
+	// Orders per planet per stats window
+	orders := pipeline.FromSlice(tasks).
+		Filter(func(ctx context.Context, task models.Task) (bool, error) {
+			return task.Type == utils.AddOrderTask, nil
+		}).
+		Map(func(ctx context.Context, task models.Task) (models.Task, error) {
+			if err := orderList.PlaceOrder(models.Order{OrderID: task.OrderID, Planet: task.Planet, PizzaType: task.PizzaType, Items: task.Items}); err != nil {
+				logger.Errorf("Error adding order: %v", err)
+			}
+			return task, nil
+		}, pipeline.WithName("add-order"))
+	ordersPerPlanet := pipeline.TumblingTime(orders, config.OrderStatsWindow*time.Millisecond)
+
+	err := ordersPerPlanet.Sink(context.Background(), func(ctx context.Context, w pipeline.Window[models.Task]) error {
+		counts := pipeline.CountBy(w.Items, func(task models.Task) string { return task.Planet })
+		logger.Infof("Orders per planet %s - %s: %v", w.Start.Format(time.TimeOnly), w.End.Format(time.TimeOnly), counts)
+		return nil
+	})
+	if err != nil {
+		logger.Errorf("Order stats pipeline stopped: %v", err)
+	}
+
+	// Batched ingredient inserts
+	ingredients := pipeline.Map(pipeline.FromSlice(tasks).
+		Filter(func(ctx context.Context, task models.Task) (bool, error) {
+			return task.Type == utils.InsertIngTask, nil
+		}), func(ctx context.Context, task models.Task) (int, error) {
+		return task.Ingredient, nil
+	})
+
+	err = pipeline.TumblingCount(ingredients, config.IngredientBatchSize).Sink(context.Background(), func(ctx context.Context, w pipeline.Window[int]) error {
+		if err := ingredientTree.InsertBatch(w.Items); err != nil {
+			logger.Errorf("Error inserting ingredient batch: %v", err)
+		}
+		logger.Infof("Inserted ingredient batch: %v", w.Items)
+		return nil
+	})
+	if err != nil {
+		logger.Errorf("Ingredient batch pipeline stopped: %v", err)
+	}
 }
@@ -2,36 +2,72 @@ package utils
 
 import (
 	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"math/rand"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gleb-korostelev/CosmicPizza.git/config"
 	"github.com/gleb-korostelev/CosmicPizza.git/models"
 	cosmicorder "github.com/gleb-korostelev/CosmicPizza.git/service/cosmicOrder"
-	ingredienttree "github.com/gleb-korostelev/CosmicPizza.git/service/ingredientTree"
+	"github.com/gleb-korostelev/CosmicPizza.git/service/menu"
+	"github.com/gleb-korostelev/CosmicPizza.git/service/pricing"
+	"github.com/gleb-korostelev/CosmicPizza.git/service/storage"
+	"github.com/gleb-korostelev/CosmicPizza.git/service/tracker"
 	"github.com/gleb-korostelev/CosmicPizza.git/service/worker"
 	"github.com/gleb-korostelev/CosmicPizza.git/tools/logger"
 )
 
 // Random order data
 var planets = []string{"Mars", "Venus", "Jupiter", "Saturn", "Neptune", "Pluto", "Andromeda Nebula"}
-var pizzaTypes = []string{"BlackHole Pepperoni", "Galactic Cheese", "Quantum Anchoa", "Nebula Deluxe", "Supernova Supreme", "Dark Matter Veggie", "Antimatter Pizza"}
+
+// Who places and removes orders, recorded in the audit trail
+var (
+	customers   = []string{"customer:zorg", "customer:leela", "customer:marvin"}
+	dispatchers = []string{"dispatcher:ford", "dispatcher:trillian"}
+)
+
+// OrderIDs hands out the IDs of generated orders. Order lists created with
+// cosmicorder.WithIDAllocator(OrderIDs) keep it ahead of every stored ID.
+var OrderIDs = cosmicorder.NewIDAllocator(0)
+
+// Task identity: a random prefix per process plus a global sequence number
+var (
+	runID   = newRunID()
+	taskSeq atomic.Uint64
+)
 
 // Task types for fan-out processing
 const (
-	AddOrderTask    = 1
-	RemoveOrderTask = 2
-	InsertIngTask   = 3
-	SearchIngTask   = 4
+	AddOrderTask      = 1
+	RemoveOrderTask   = 2
+	InsertIngTask     = 3
+	SearchIngTask     = 4
+	AdvanceOrderTask  = 5
+	CheckoutOrderTask = 6
+	PrepareOrderTask  = 7
+	UpdateOrderTask   = 8
+	MoveOrderTask     = 9
+	SwapOrdersTask    = 10
+	ExpireOrdersTask  = 11
+	RemoveIngTask     = 12
+	UndoOrdersTask    = 13
+	RevertOrdersTask  = 14
 )
 
 // ProcessOrder add's order in orderList and processing it
-func ProcessOrder(orderList *cosmicorder.CosmicOrderList, order models.Order) worker.Task {
+func ProcessOrder(orderList storage.OrderStore, order models.Order) worker.Task {
 	return worker.Task{
 		Action: func(ctx context.Context) error {
-			orderList.AddOrder(order.OrderID, order.Planet, order.PizzaType)
-			logger.Infof("Processed order #%d from %s: %s", order.OrderID, order.Planet, order.PizzaType)
+			if err := orderList.PlaceOrder(order); err != nil {
+				return err
+			}
+			logger.Infof("Processed order #%d from %s: %v", order.OrderID, order.Planet, order.Items)
 			time.Sleep(config.OrderProcessTime * time.Millisecond) // Job simulation
 			return nil
 		},
@@ -40,10 +76,12 @@ func ProcessOrder(orderList *cosmicorder.CosmicOrderList, order models.Order) wo
 }
 
 // ProcessIngredient adds new ingridient to the tree
-func ProcessIngredient(tree *ingredienttree.IngredientTree, ingredient int) worker.Task {
+func ProcessIngredient(tree storage.IngredientStore, ingredient int) worker.Task {
 	return worker.Task{
 		Action: func(ctx context.Context) error {
-			tree.Insert(ingredient + 1)
+			if err := tree.Insert(ingredient + 1); err != nil {
+				return err
+			}
 			logger.Infof("Inserted ingredient: %d", ingredient)
 			time.Sleep(config.IngredientProcessTime * time.Millisecond) // Job simulation
 			return nil
@@ -52,23 +90,62 @@ func ProcessIngredient(tree *ingredienttree.IngredientTree, ingredient int) work
 	}
 }
 
-// GenerateRandomOrder creates a random order
+// GenerateRandomOrder creates a random order with up to config.MaxOrderItems line items
 func GenerateRandomOrder(orderID int) models.Order {
+	items := make([]models.LineItem, rand.Intn(config.MaxOrderItems)+1)
+	for i := range items {
+		items[i] = GenerateRandomLineItem()
+	}
+
 	return models.Order{
 		OrderID:   orderID,
 		Planet:    planets[rand.Intn(len(planets))],
-		PizzaType: pizzaTypes[rand.Intn(len(pizzaTypes))],
+		PizzaType: items[0].PizzaType,
+		Items:     items,
+		Priority:  rand.Intn(config.MaxOrderPriority + 1),
+		VIP:       rand.Intn(100) < config.VIPOrderPercent,
+		Deadline:  time.Now().Add(time.Duration(rand.Intn(config.MaxOrderDeadline)+1) * time.Minute),
 		Next:      nil,
 	}
 }
 
+// GenerateRandomLineItem creates a random pizza with random extra toppings from the menu
+func GenerateRandomLineItem() models.LineItem {
+	item := models.LineItem{
+		PizzaType: menu.PizzaTypes[rand.Intn(len(menu.PizzaTypes))],
+		Size:      menu.Sizes[rand.Intn(len(menu.Sizes))],
+		Quantity:  rand.Intn(config.MaxItemQuantity) + 1,
+	}
+	for _, i := range rand.Perm(len(menu.Toppings))[:rand.Intn(config.MaxExtraToppings+1)] {
+		item.Toppings = append(item.Toppings, menu.Toppings[i])
+	}
+	return item
+}
+
 // GenerateRandomIngredient creates a random magical ingredient
 func GenerateRandomIngredient() int {
 	return rand.Intn(config.MaxIngredientNumber) + 1 // Random number between 1 and 100
 }
 
+// newRunID returns a random prefix that keeps task IDs unique across runs
+func newRunID() string {
+	b := make([]byte, 4)
+	if _, err := crand.Read(b); err != nil {
+		return fmt.Sprintf("%08x", time.Now().UnixNano()&0xffffffff)
+	}
+	return hex.EncodeToString(b)
+}
+
+// NewTask gives the task a unique ID, a sequence number and its creation time
+func NewTask(task models.Task) models.Task {
+	task.Seq = taskSeq.Add(1)
+	task.ID = fmt.Sprintf("%s-%06d", runID, task.Seq)
+	task.CreatedAt = time.Now()
+	return task
+}
+
 // ProcessTasks reads from the output channels and executes corresponding actions
-func ProcessTasks(workerPool *worker.WorkerPool, orderList *cosmicorder.CosmicOrderList, ingredientTree *ingredienttree.IngredientTree, outputChs []chan models.Task, wg *sync.WaitGroup) chan models.Task {
+func ProcessTasks(workerPool *worker.WorkerPool, orderList storage.OrderStore, ingredientTree storage.IngredientStore, outputChs []chan models.Task, wg *sync.WaitGroup, tr *tracker.Tracker, journal Journal) chan models.Task {
 	processedCh := make(chan models.Task)
 
 	go func() {
@@ -81,8 +158,13 @@ func ProcessTasks(workerPool *worker.WorkerPool, orderList *cosmicorder.CosmicOr
 					// logger.Infof("ProcessTasks task is being processed %v", task)
 					workerPool.AddTask(worker.Task{
 						Action: func(ctx context.Context) error {
-							err := SwitchProcessTasks(ctx, task, orderList, ingredientTree)
-							return err
+							task := tr.Started(task)
+							err := SwitchProcessTasks(ctx, task, orderList, ingredientTree, journal)
+							tr.Finished(task)
+							if err != nil {
+								return fmt.Errorf("task %s: %w", task.ID, err)
+							}
+							return nil
 						},
 						Done: make(chan struct{}),
 					})
@@ -96,22 +178,218 @@ func ProcessTasks(workerPool *worker.WorkerPool, orderList *cosmicorder.CosmicOr
 	return processedCh
 }
 
-func SwitchProcessTasks(ctx context.Context, task models.Task, orderList *cosmicorder.CosmicOrderList, ingredientTree *ingredienttree.IngredientTree) error {
+// Journal records mutations, e.g. in a write-ahead log. Commit runs apply and records the task
+// only if it succeeded; apply may fill in what it resolved, so replaying the task repeats it exactly.
+type Journal interface {
+	Commit(task models.Task, apply func(task *models.Task) error) error
+}
+
+// SwitchProcessTasks executes a single task. Mutating tasks go through journal when it is not nil.
+func SwitchProcessTasks(ctx context.Context, task models.Task, orderList storage.OrderStore, ingredientTree storage.IngredientStore, journal Journal) error {
+	var apply func(task *models.Task) error
 	switch task.Type {
 	case AddOrderTask:
-		orderList.AddOrder(task.OrderID, task.Planet, task.PizzaType)
+		apply = func(task *models.Task) error {
+			order := models.Order{
+				OrderID:   task.OrderID,
+				Planet:    task.Planet,
+				PizzaType: task.PizzaType,
+				Items:     task.Items,
+				Priority:  task.Priority,
+				VIP:       task.VIP,
+				Deadline:  task.Deadline,
+				ExpiresAt: task.ExpiresAt,
+			}
+			var err error
+			if audited, ok := orderList.(storage.AuditedOrderStore); ok {
+				err = audited.PlaceOrderAs(task.Actor, order)
+			} else {
+				err = orderList.PlaceOrder(order)
+			}
+			if err != nil {
+				return err
+			}
+			// Journal the expiry stamped at placement, replays happen later
+			if placed, ok := orderList.Get(task.OrderID); ok {
+				task.ExpiresAt = placed.ExpiresAt
+			}
+			return nil
+		}
 		// logger.Infof("Added Order #%d from %s: %s", task.OrderID, task.Planet, task.PizzaType)
 	case RemoveOrderTask:
-		orderList.RemoveOrder(task.OrderID)
+		apply = func(task *models.Task) error {
+			if audited, ok := orderList.(storage.AuditedOrderStore); ok {
+				return audited.RemoveOrderAs(task.Actor, task.OrderID)
+			}
+			return orderList.RemoveOrder(task.OrderID)
+		}
 		// logger.Infof("Removed Order #%d", task.OrderID)
 	case InsertIngTask:
-		ingredientTree.Insert(task.Ingredient)
+		apply = func(task *models.Task) error {
+			return ingredientTree.Insert(task.Ingredient)
+		}
 		// logger.Infof("Inserted Ingredient: %d", task.Ingredient)
+	case RemoveIngTask:
+		apply = func(task *models.Task) error {
+			return ingredientTree.Delete(task.Ingredient)
+		}
+		// logger.Infof("Removed Ingredient: %d", task.Ingredient)
 	case SearchIngTask:
 		_ = ingredientTree.Search(task.Ingredient)
 		// logger.Infof("Searched Ingredient %d: Found? %v", task.Ingredient, found)
+		return nil
+	case AdvanceOrderTask:
+		apply = func(task *models.Task) error {
+			return orderList.Advance(task.OrderID, task.Status)
+		}
+		// logger.Infof("Order #%d moved to %s", task.OrderID, task.Status)
+	case CheckoutOrderTask:
+		apply = func(task *models.Task) error {
+			// A journaled checkout carries its receipt, prices may depend on the time of day
+			if task.Receipt != nil {
+				return orderList.AttachReceipt(task.OrderID, *task.Receipt)
+			}
+			receipt, err := orderList.Checkout(task.OrderID, task.PromoCode)
+			if err != nil {
+				return err
+			}
+			task.Receipt = &receipt
+			return nil
+		}
+		// logger.Infof("Order #%d checked out", task.OrderID)
+	case UpdateOrderTask:
+		apply = func(task *models.Task) error {
+			before, _ := orderList.Get(task.OrderID)
+			after, err := orderList.UpdateOrder(task.OrderID, models.OrderPatch{
+				Planet:    task.Planet,
+				PizzaType: task.PizzaType,
+				Revision:  task.Revision,
+			})
+			if err != nil {
+				return err
+			}
+			if after.Revision == before.Revision {
+				return errUnchanged
+			}
+			return nil
+		}
+		// logger.Infof("Order #%d updated", task.OrderID)
+	case MoveOrderTask:
+		apply = func(task *models.Task) error {
+			return orderList.MoveOrder(task.OrderID, task.Index)
+		}
+		// logger.Infof("Order #%d moved to %d", task.OrderID, task.Index)
+	case SwapOrdersTask:
+		apply = func(task *models.Task) error {
+			return orderList.Swap(task.OrderID, task.SwapWith)
+		}
+		// logger.Infof("Orders #%d and #%d swapped", task.OrderID, task.SwapWith)
+	case ExpireOrdersTask:
+		apply = func(task *models.Task) error {
+			if expiring, ok := orderList.(storage.ExpiringOrderStore); ok {
+				_, err := expiring.ExpireOrders(task.CreatedAt, task.OrderIDs)
+				return err
+			}
+			return nil
+		}
+		// logger.Infof("Expired orders %v", task.OrderIDs)
+	case UndoOrdersTask, RevertOrdersTask:
+		apply = func(task *models.Task) error {
+			revertible, ok := orderList.(storage.RevertibleOrderStore)
+			if !ok {
+				return fmt.Errorf("revert orders: %w", errors.ErrUnsupported)
+			}
+			// A journaled task names the audit entries it reverted, the trail may differ at replay
+			if len(task.Reverts) > 0 {
+				return revertible.Revert(task.Actor, task.Reverts)
+			}
+
+			var (
+				seqs []uint64
+				err  error
+			)
+			if task.Type == UndoOrdersTask {
+				seqs, err = revertible.Undo(task.Actor, task.Steps)
+			} else {
+				seqs, err = revertible.RevertTo(task.Actor, task.RevertTo)
+			}
+			if err != nil {
+				return err
+			}
+			if len(seqs) == 0 {
+				return errUnchanged
+			}
+			task.Reverts = seqs
+			return nil
+		}
+		// logger.Infof("Reverted audit entries %v", task.Reverts)
+	case PrepareOrderTask:
+		apply = func(task *models.Task) error {
+			// A journaled task names the order the kitchen took, the queue may differ at replay
+			if task.OrderID != 0 {
+				return orderList.Advance(task.OrderID, models.StatusPreparing)
+			}
+			order, err := orderList.NextToPrepare()
+			if err != nil {
+				return err
+			}
+			task.OrderID = order.OrderID
+			return nil
+		}
+		// logger.Infof("Kitchen started preparing order #%d", task.OrderID)
+	default:
+		return nil
+	}
+
+	var err error
+	if journal == nil {
+		err = apply(&task)
+	} else {
+		err = journal.Commit(task, apply)
+	}
+	if errors.Is(err, errUnchanged) {
+		return nil
+	}
+	return err
+}
+
+// errUnchanged keeps tasks that changed nothing, e.g. expiry runs that expired no order, out of the journal.
+var errUnchanged = errors.New("nothing changed")
+
+// ExpireOrders returns the function the reaper runs to expire the orders of orderList.
+// When journal is not nil, every run that expired orders is journaled as an ExpireOrdersTask
+// listing their IDs, so recovery expires the same orders whatever the clock says.
+func ExpireOrders(orderList storage.ExpiringOrderStore, journal Journal) func(now time.Time) ([]models.Order, error) {
+	return func(now time.Time) ([]models.Order, error) {
+		task := NewTask(models.Task{Type: ExpireOrdersTask})
+		task.CreatedAt = now
+
+		var expired []models.Order
+		apply := func(task *models.Task) error {
+			var err error
+			expired, err = orderList.Expire(now)
+			if err != nil {
+				return err
+			}
+			if len(expired) == 0 {
+				return errUnchanged
+			}
+			for _, order := range expired {
+				task.OrderIDs = append(task.OrderIDs, order.OrderID)
+			}
+			return nil
+		}
+		var err error
+		if journal == nil {
+			err = apply(&task)
+		} else {
+			err = journal.Commit(task, apply)
+		}
+		if err != nil && !errors.Is(err, errUnchanged) {
+			return expired, err
+		}
+		return expired, nil
 	}
-	return nil
 }
 
 // Generate random tasks for orders and ingredients
@@ -119,45 +397,130 @@ func GenerateTasks() []models.Task {
 	tasks := []models.Task{}
 
 	// Generate random orders
-	for i := 1; i <= config.OrderTaskNumber; i++ {
-		order := GenerateRandomOrder(i)
-		tasks = append(tasks, models.Task{
-			Type:      AddOrderTask,
-			OrderID:   order.OrderID,
-			Planet:    order.Planet,
-			PizzaType: order.PizzaType,
-		})
+	ids := make([]int, config.OrderTaskNumber)
+	for i := range ids {
+		ids[i] = OrderIDs.Next()
+		order := GenerateRandomOrder(ids[i])
+		tasks = append(tasks, NewTask(models.Task{
+			Type:    AddOrderTask,
+			OrderID: order.OrderID,
+			Actor:   customers[rand.Intn(len(customers))],
+			OrderPayload: models.OrderPayload{
+				Planet:    order.Planet,
+				PizzaType: order.PizzaType,
+				Items:     order.Items,
+				Priority:  order.Priority,
+				VIP:       order.VIP,
+				Deadline:  order.Deadline,
+			},
+		}))
+	}
+
+	// Place some orders again under an ID that is already taken
+	for i := 1; i <= config.DuplicateTaskNumber; i++ {
+		order := GenerateRandomOrder(ids[rand.Intn(len(ids))])
+		tasks = append(tasks, NewTask(models.Task{
+			Type:         AddOrderTask,
+			OrderID:      order.OrderID,
+			Actor:        customers[rand.Intn(len(customers))],
+			OrderPayload: models.OrderPayload{Planet: order.Planet, PizzaType: order.PizzaType, Items: order.Items},
+		}))
 	}
 
 	// Remove half random orders
 	for i := 1; i <= config.OrderTaskNumber/2; i++ {
-		tasks = append(tasks, models.Task{
+		tasks = append(tasks, NewTask(models.Task{
 			Type:    RemoveOrderTask,
-			OrderID: rand.Intn(config.OrderTaskNumber) + 1,
-		})
+			OrderID: ids[rand.Intn(len(ids))],
+			Actor:   dispatchers[rand.Intn(len(dispatchers))],
+		}))
+	}
+
+	// Start preparing some random orders
+	for i := 1; i <= config.StatusTaskNumber; i++ {
+		tasks = append(tasks, NewTask(models.Task{
+			Type:    AdvanceOrderTask,
+			OrderID: ids[rand.Intn(len(ids))],
+			Status:  models.StatusPreparing,
+		}))
+	}
+
+	// Edit some random orders, expecting them to be unedited so far
+	for i := 1; i <= config.UpdateTaskNumber; i++ {
+		task := models.Task{
+			Type:         UpdateOrderTask,
+			OrderID:      ids[rand.Intn(len(ids))],
+			OrderPayload: models.OrderPayload{Planet: planets[rand.Intn(len(planets))], Revision: 1},
+		}
+		if rand.Intn(2) == 0 {
+			task.PizzaType = menu.PizzaTypes[rand.Intn(len(menu.PizzaTypes))]
+		}
+		tasks = append(tasks, NewTask(task))
+	}
+
+	// Reorder the list: move some random orders and swap some random pairs
+	for i := 1; i <= config.MoveTaskNumber; i++ {
+		tasks = append(tasks, NewTask(models.Task{
+			Type:           MoveOrderTask,
+			OrderID:        ids[rand.Intn(len(ids))],
+			ReorderPayload: models.ReorderPayload{Index: rand.Intn(len(ids))},
+		}))
+		tasks = append(tasks, NewTask(models.Task{
+			Type:           SwapOrdersTask,
+			OrderID:        ids[rand.Intn(len(ids))],
+			ReorderPayload: models.ReorderPayload{SwapWith: ids[rand.Intn(len(ids))]},
+		}))
+	}
+
+	// Let the kitchen pull the most urgent orders
+	for i := 1; i <= config.PrepareTaskNumber; i++ {
+		tasks = append(tasks, NewTask(models.Task{Type: PrepareOrderTask}))
+	}
+
+	// Check out some random orders, sometimes with a promo code
+	for i := 1; i <= config.CheckoutTaskNumber; i++ {
+		promoCode := ""
+		if rand.Intn(2) == 0 {
+			promoCode = pricing.DefaultPromoCodes[rand.Intn(len(pricing.DefaultPromoCodes))].Code
+		}
+		tasks = append(tasks, NewTask(models.Task{
+			Type:            CheckoutOrderTask,
+			OrderID:         ids[rand.Intn(len(ids))],
+			CheckoutPayload: models.CheckoutPayload{PromoCode: promoCode},
+		}))
 	}
 
 	// Generate random ingredient insertions
-	for i := 0; i < config.IngredientTaskNumber; i++ {
-		tasks = append(tasks, models.Task{
+	ingredients := make([]int, config.IngredientTaskNumber)
+	for i := range ingredients {
+		ingredients[i] = GenerateRandomIngredient()
+		tasks = append(tasks, NewTask(models.Task{
 			Type:       InsertIngTask,
-			Ingredient: GenerateRandomIngredient(),
-		})
+			Ingredient: ingredients[i],
+		}))
 		// logger.Infof("Ingredient generated %d", tasks[i].Ingredient)
 	}
 
+	// Remove some of them again, consumed or spoiled
+	for i := 0; i < config.RemoveIngTaskNumber; i++ {
+		tasks = append(tasks, NewTask(models.Task{
+			Type:       RemoveIngTask,
+			Ingredient: ingredients[rand.Intn(len(ingredients))],
+		}))
+	}
+
 	// Search for some ingredients
 	for i := 0; i < config.IngredientTaskNumber; i++ {
-		tasks = append(tasks, models.Task{
+		tasks = append(tasks, NewTask(models.Task{
 			Type:       SearchIngTask,
 			Ingredient: GenerateRandomIngredient(),
-		})
+		}))
 	}
 
 	return tasks
 }
 
-func ChanGenerator(tasks []models.Task, doneCh chan struct{}) chan models.Task {
+func ChanGenerator(tasks []models.Task, doneCh chan struct{}, tr *tracker.Tracker) chan models.Task {
 
 	inputCh := make(chan models.Task)
 
@@ -168,7 +531,7 @@ func ChanGenerator(tasks []models.Task, doneCh chan struct{}) chan models.Task {
 			select {
 			case <-doneCh:
 				return
-			case inputCh <- task:
+			case inputCh <- tr.Enqueued(task):
 				// logger.Infof("ChanGenerator: Sent task to FanOut: %+v", task)
 			}
 		}
@@ -178,18 +541,20 @@ func ChanGenerator(tasks []models.Task, doneCh chan struct{}) chan models.Task {
 }
 
 // CollectResults gathers all results in the main thread
-func CollectResults(orderList *cosmicorder.CosmicOrderList, ingredientTree *ingredienttree.IngredientTree, outputCh chan models.Task) {
+func CollectResults(orderList storage.OrderStore, ingredientTree storage.IngredientStore, outputCh chan models.Task, tr *tracker.Tracker) {
 	remainingOrders := []models.Order{}
 	remainingIngredients := []int{}
 	antimatterPizzaFound := false
 
 	for task := range outputCh {
+		tr.Collected(task)
 		switch task.Type {
 		case AddOrderTask:
 			remainingOrders = append(remainingOrders, models.Order{
 				OrderID:   task.OrderID,
 				Planet:    task.Planet,
 				PizzaType: task.PizzaType,
+				Items:     task.Items,
 				Next:      nil,
 			})
 		case RemoveOrderTask:
@@ -202,10 +567,14 @@ func CollectResults(orderList *cosmicorder.CosmicOrderList, ingredientTree *ingr
 			}
 		case InsertIngTask:
 			remainingIngredients = append(remainingIngredients, task.Ingredient)
+		case RemoveIngTask:
+			if i := slices.Index(remainingIngredients, task.Ingredient); i >= 0 {
+				remainingIngredients = slices.Delete(remainingIngredients, i, i+1)
+			}
 		}
 
 		// Check if "Antimatter Pizza" is still in the menu
-		if task.PizzaType == "Antimatter Pizza" {
+		if task.PizzaType == "Antimatter Pizza" || slices.ContainsFunc(task.Items, func(item models.LineItem) bool { return item.PizzaType == "Antimatter Pizza" }) {
 			antimatterPizzaFound = true
 		}
 	}